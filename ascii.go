@@ -2,10 +2,16 @@ package term
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // ASCII list the possible supported ASCII key sequence
+//
+// It is kept for compatibility. Parsing and formatting keys use a copy of it
+// that is made when the package is initialized, so changing it has no effect.
 var ASCII = []string{
 	"ctrl-@",
 	"ctrl-a",
@@ -41,26 +47,114 @@ var ASCII = []string{
 	"ctrl-_",
 }
 
+// ctrlKeyNames holds the names of the control keys, indexed by their codes. It
+// is a copy of ASCII, which callers may modify.
+var ctrlKeyNames = append([]string(nil), ASCII...)
+
+// namedKeys maps the names of keys accepted by [ToBytes] to their codes.
+var namedKeys = map[string]byte{
+	"esc":       27,
+	"tab":       9,
+	"enter":     13,
+	"space":     32,
+	"backspace": 127,
+	"del":       127,
+}
+
 // ToBytes converts a string representing a suite of key-sequence to the corresponding ASCII code.
+//
+// Keys are separated by commas, and each key is one of:
+//
+//   - a control key, such as "ctrl-p", in any case, from "ctrl-@" to "ctrl-_";
+//   - a control key in caret notation, such as "^P", or "^?" for DEL;
+//   - a named key: "esc", "tab", "enter", "space", "backspace" or "DEL", in
+//     any case;
+//   - a key with the alt (or meta) modifier, such as "alt-x" or "meta-x",
+//     which sends ESC followed by the key;
+//   - a hexadecimal code, such as "0x10";
+//   - a single character, which is encoded as UTF-8.
+//
+// See [ParseKeySequence] to parse keys into a [KeySequence] instead.
 func ToBytes(keys string) ([]byte, error) {
-	codes := []byte{}
-next:
-	for _, key := range strings.Split(keys, ",") {
-		if len(key) != 1 {
-			for code, ctrl := range ASCII {
-				if ctrl == key {
-					codes = append(codes, byte(code))
-					continue next
-				}
+	seq, err := ParseKeySequence(keys)
+	if err != nil {
+		return nil, err
+	}
+	return seq.Bytes(), nil
+}
+
+// keyBytes converts a single key, in one of the forms accepted by [ToBytes],
+// to the bytes it sends.
+func keyBytes(key string) ([]byte, error) {
+	if r, size := utf8.DecodeRuneInString(key); size == len(key) && r != utf8.RuneError {
+		return []byte(key), nil
+	}
+	if code, ok := namedKeys[strings.ToLower(key)]; ok {
+		return []byte{code}, nil
+	}
+	if len(key) == 2 && key[0] == '^' {
+		if key[1] == '?' {
+			return []byte{127}, nil
+		}
+		if c := unicode.ToUpper(rune(key[1])); c >= '@' && c <= '_' {
+			return []byte{byte(c) & 0x1f}, nil
+		}
+	}
+	if name, ok := cutPrefixFold(key, "ctrl-"); ok {
+		name = "ctrl-" + strings.ToLower(name)
+		for code, ctrl := range ctrlKeyNames {
+			if ctrl == name {
+				return []byte{byte(code)}, nil
 			}
-			if key == "DEL" {
-				codes = append(codes, 127)
-			} else {
-				return nil, fmt.Errorf("unknown character: '%s'", key)
+		}
+	}
+	for _, prefix := range []string{"alt-", "meta-"} {
+		if name, ok := cutPrefixFold(key, prefix); ok && name != "" {
+			code, err := keyBytes(name)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			codes = append(codes, key[0])
+			return append([]byte{27}, code...), nil
+		}
+	}
+	if hex, ok := cutPrefixFold(key, "0x"); ok && hex != "" {
+		if code, err := strconv.ParseUint(hex, 16, 8); err == nil {
+			return []byte{byte(code)}, nil
 		}
 	}
-	return codes, nil
+	return nil, fmt.Errorf("unknown character: '%s'", key)
+}
+
+// cutPrefixFold is like strings.CutPrefix, but matches the prefix under
+// Unicode case-folding.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// FromBytes converts a key-sequence to its string representation, in the
+// canonical comma-separated form accepted by [ToBytes], such as
+// "ctrl-p,ctrl-q". It uses the same names as [KeySequence.String]: ESC
+// followed by another key is named with the alt- prefix, such as "alt-x",
+// multi-byte UTF-8 characters are kept as they are, and bytes that have no
+// other name, such as ',' and bytes that are not valid UTF-8, are written in
+// hexadecimal, such as "0x2c". The error is always nil, and is kept for
+// compatibility.
+func FromBytes(codes []byte) (string, error) {
+	return keySequenceFromBytes(codes).String(), nil
+}
+
+// keyName returns the name of the key that produces the given byte, in the
+// form accepted by [ToBytes].
+func keyName(c byte) string {
+	switch {
+	case int(c) < len(ctrlKeyNames):
+		return ctrlKeyNames[c]
+	case c == 127:
+		return "DEL"
+	default:
+		return string([]byte{c})
+	}
 }
@@ -38,3 +38,103 @@ func TestToBytes(t *testing.T) {
 		t.Errorf("expected: %+v, got: %+v", expected, codes)
 	}
 }
+
+func TestFromBytes(t *testing.T) {
+	for _, tc := range []struct {
+		codes    []byte
+		expected string
+	}{
+		{codes: nil, expected: ""},
+		{codes: []byte{16, 17}, expected: "ctrl-p,ctrl-q"},
+		{codes: []byte{0, 126, 15, 27}, expected: "ctrl-@,~,ctrl-o,ctrl-["},
+		{codes: []byte{127, 43, 32}, expected: "DEL,+, "},
+		{codes: []byte{','}, expected: "0x2c"},
+		{codes: []byte{0xc3, 0xa9, 0xff}, expected: "é,0xff"},
+		{codes: []byte{27, 'x', 27, 27, 16}, expected: "alt-x,ctrl-[,alt-ctrl-p"},
+	} {
+		keys, err := FromBytes(tc.codes)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if keys != tc.expected {
+			t.Errorf("expected: %q, got: %q", tc.expected, keys)
+		}
+		seq, err := ParseKeySequence(keys)
+		if len(tc.codes) == 0 {
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if seq.String() != keys {
+			t.Errorf("expected: %q, got: %q", keys, seq.String())
+		}
+		codes, err := ToBytes(keys)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(codes, tc.codes) {
+			t.Errorf("expected: %+v, got: %+v", tc.codes, codes)
+		}
+	}
+}
+
+func TestToBytesGrammar(t *testing.T) {
+	for _, tc := range []struct {
+		keys     string
+		expected []byte
+		err      bool
+	}{
+		{keys: "Ctrl-P,CTRL-q", expected: []byte{16, 17}},
+		{keys: "^P,^q,^[,^?", expected: []byte{16, 17, 27, 127}},
+		{keys: "^", expected: []byte{'^'}},
+		{keys: "esc,Tab,ENTER,space,backspace,del", expected: []byte{27, 9, 13, 32, 127, 127}},
+		{keys: "alt-x,Meta-X,alt-ctrl-p", expected: []byte{27, 'x', 27, 'X', 27, 16}},
+		{keys: "0x10,0X1b,0xff", expected: []byte{16, 27, 255}},
+		{keys: "é", expected: []byte{0xc3, 0xa9}},
+		{keys: "ab", err: true},
+		{keys: "éa", err: true},
+		{keys: "alt-", err: true},
+		{keys: "0x", err: true},
+		{keys: "0x100", err: true},
+		{keys: "^1", err: true},
+		{keys: "ctrl-1", err: true},
+		{keys: "", err: true},
+	} {
+		codes, err := ToBytes(tc.keys)
+		if tc.err {
+			if err == nil {
+				t.Errorf("expected an error for %q, got: %+v", tc.keys, codes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(codes, tc.expected) {
+			t.Errorf("expected: %+v, got: %+v", tc.expected, codes)
+		}
+	}
+}
+
+func TestASCIIModified(t *testing.T) {
+	saved := ASCII[16]
+	ASCII[16] = "ctrl-x"
+	defer func() {
+		ASCII[16] = saved
+	}()
+
+	codes, err := ToBytes("ctrl-p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{16}; !bytes.Equal(codes, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, codes)
+	}
+	if keys, _ := FromBytes([]byte{24}); keys != "ctrl-x" {
+		t.Errorf("expected: %q, got: %q", "ctrl-x", keys)
+	}
+}
@@ -0,0 +1,104 @@
+package term
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultDetachKeys is the detach key sequence used when none is configured.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// detachEscapeName is the name of the escape sequence reported in the
+// EscapeError returned by proxies created from DetachKeys.
+const detachEscapeName = "detach"
+
+// reservedDetachKeys are the keys a detach key sequence cannot start with,
+// as the proxy would hold them back until the next key is typed, which
+// delays what the terminal does for them.
+var reservedDetachKeys = map[byte]string{
+	0x03: "interrupt",
+	0x04: "end of input",
+	0x1a: "suspend",
+	0x1c: "quit",
+}
+
+// DetachKeys is a detach key sequence, as configured by the "detachKeys"
+// setting of Docker-style clients. The zero value is the
+// [DefaultDetachKeys] sequence.
+type DetachKeys struct {
+	seq KeySequence
+}
+
+// ParseDetachKeys parses a detach key sequence in the form accepted by
+// [ParseKeySequence], such as "ctrl-p,ctrl-q". If s is empty, it returns
+// the [DefaultDetachKeys] sequence.
+//
+// It returns an error if the sequence is not valid as defined by
+// [KeySequence.Validate], if it starts with a key that the terminal handles
+// itself, such as ctrl-c or ctrl-d, or if it starts with ESC, such as "esc",
+// "ctrl-[" or "alt-x", which would be ambiguous with the sequences sent by
+// arrow and function keys.
+func ParseDetachKeys(s string) (DetachKeys, error) {
+	if s == "" {
+		return DetachKeys{}, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		if name == "" {
+			return DetachKeys{}, fmt.Errorf("invalid detach keys %q: empty key", s)
+		}
+	}
+	seq, err := ParseKeySequence(s)
+	if err != nil {
+		return DetachKeys{}, fmt.Errorf("invalid detach keys %q: %w", s, err)
+	}
+	if err := seq.Validate(); err != nil {
+		return DetachKeys{}, fmt.Errorf("invalid detach keys %q: %w", s, err)
+	}
+	code := seq[0].Bytes()
+	if code[0] == 0x1b {
+		return DetachKeys{}, fmt.Errorf("invalid detach keys %q: %s starts the sequences sent by arrow and function keys", s, seq[0])
+	}
+	if use, ok := reservedDetachKeys[code[0]]; ok && len(code) == 1 {
+		return DetachKeys{}, fmt.Errorf("invalid detach keys %q: %s is used to %s", s, seq[0], use)
+	}
+	return DetachKeys{seq: seq}, nil
+}
+
+func (d DetachKeys) keys() KeySequence {
+	if len(d.seq) == 0 {
+		seq, _ := ParseKeySequence(DefaultDetachKeys)
+		return seq
+	}
+	return d.seq
+}
+
+// Keys returns the keys of the detach key sequence.
+func (d DetachKeys) Keys() KeySequence {
+	return append(KeySequence(nil), d.keys()...)
+}
+
+// Bytes returns the bytes that the detach key sequence sends.
+func (d DetachKeys) Bytes() []byte {
+	return d.keys().Bytes()
+}
+
+// String returns the canonical form of the detach key sequence, such as
+// "ctrl-p,ctrl-q".
+func (d DetachKeys) String() string {
+	return d.keys().String()
+}
+
+// EscapeOption returns an option that adds the detach key sequence to a proxy
+// created by [NewEscapeProxyWithOptions]. When the sequence is read, the
+// proxy returns an [EscapeError] named "detach".
+func (d DetachKeys) EscapeOption() EscapeOption {
+	return WithEscapeSequence(detachEscapeName, d.Bytes())
+}
+
+// NewProxy returns a proxy reader which wraps the given reader, and detects
+// the detach key sequence, as well as the escape sequences configured by the
+// given options.
+func (d DetachKeys) NewProxy(r io.Reader, opts ...EscapeOption) io.Reader {
+	return NewEscapeProxyWithOptions(r, append([]EscapeOption{d.EscapeOption()}, opts...)...)
+}
@@ -0,0 +1,68 @@
+package term
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	for _, tc := range []struct {
+		keys     string
+		expected string
+		err      bool
+	}{
+		{keys: "", expected: DefaultDetachKeys},
+		{keys: "ctrl-p,ctrl-q", expected: "ctrl-p,ctrl-q"},
+		{keys: "^A,d", expected: "ctrl-a,d"},
+		{keys: "ctrl-d,ctrl-p", err: true},
+		{keys: "ctrl-c", err: true},
+		{keys: "ctrl-\\", err: true},
+		{keys: "ctrl-z,x", err: true},
+		{keys: "ctrl-p,,ctrl-q", err: true},
+		{keys: ",", err: true},
+		{keys: "a", err: true},
+		{keys: "shift-z", err: true},
+		{keys: "esc", err: true},
+		{keys: "ctrl-[", err: true},
+		{keys: "alt-x", err: true},
+		{keys: "esc,ctrl-q", err: true},
+		{keys: "ctrl-p,esc", expected: "ctrl-p,ctrl-["},
+	} {
+		d, err := ParseDetachKeys(tc.keys)
+		if tc.err {
+			if err == nil {
+				t.Errorf("expected an error for %q, got: %v", tc.keys, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if d.String() != tc.expected {
+			t.Errorf("expected: %q, got: %q", tc.expected, d.String())
+		}
+	}
+
+	var d DetachKeys
+	if expected := []byte{16, 17}; !bytes.Equal(d.Bytes(), expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, d.Bytes())
+	}
+}
+
+func TestDetachKeysNewProxy(t *testing.T) {
+	d, err := ParseDetachKeys("ctrl-a,d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := d.NewProxy(bytes.NewReader([]byte("ab\x01dc")))
+	out, err := io.ReadAll(reader)
+	if expected := (EscapeError{Name: "detach", Keys: "\x01d"}); !errors.Is(err, expected) {
+		t.Errorf("expected: %v, got: %v", expected, err)
+	}
+	if expected := "ab"; string(out) != expected {
+		t.Errorf("expected: %q, got: %q", expected, out)
+	}
+}
@@ -0,0 +1,86 @@
+package term
+
+import "sync"
+
+// Restorer restores the terminal connected to a file descriptor to the state
+// it was in when [Guard] was called.
+type Restorer struct {
+	fd    uintptr
+	state *State
+	stop  func()
+
+	once sync.Once
+	err  error
+}
+
+// Guard saves the state of the terminal connected to the given file descriptor
+// and returns a [Restorer] that restores it. The terminal is restored when:
+//
+//   - [Restorer.Restore] is called, typically deferred after changing the
+//     terminal mode;
+//   - a goroutine that deferred [Restorer.RestoreOnPanic] panics;
+//   - the process receives a signal that terminates it. On Unix, these are
+//     SIGINT, SIGTERM and SIGHUP; on Windows, these are the Ctrl-C and
+//     Ctrl-Break events, and closing the console, logging off or shutting down.
+//
+// Signals are not consumed, and the process is not terminated by the guard:
+// after restoring the terminal, the signal is handled as if the guard was not
+// installed, which terminates the process unless it is handled elsewhere. On
+// Unix, the signal is raised again after restoring the terminal, so channels
+// registered with [os/signal.Notify] receive it twice.
+//
+// The terminal is restored at most once; after it has been restored, the
+// guard no longer handles signals.
+func Guard(fd uintptr) (*Restorer, error) {
+	state, err := SaveState(fd)
+	if err != nil {
+		return nil, err
+	}
+	r := &Restorer{fd: fd, state: state}
+	r.stop = onTerminate(func() {
+		_ = r.restore()
+	})
+	return r, nil
+}
+
+// State returns the terminal state that is restored by the Restorer.
+func (r *Restorer) State() *State {
+	return r.state
+}
+
+// Restore restores the terminal to its saved state, and stops handling
+// signals. It is safe to call Restore multiple times, and from multiple
+// goroutines; the terminal is only restored once, and subsequent calls return
+// the result of the first call.
+func (r *Restorer) Restore() error {
+	r.stop()
+	return r.restore()
+}
+
+// restore restores the terminal once. Unlike Restore, it does not use r.stop,
+// so that it can be called by the signal handler before Guard returns.
+func (r *Restorer) restore() error {
+	r.once.Do(func() {
+		r.err = RestoreTerminal(r.fd, r.state)
+	})
+	return r.err
+}
+
+// RestoreOnPanic restores the terminal if the calling goroutine is panicking,
+// and continues panicking afterwards. It must be called directly as a deferred
+// function:
+//
+//	go func() {
+//		defer r.RestoreOnPanic()
+//		// ...
+//	}()
+//
+// A panic in a goroutine terminates the process without running the deferred
+// functions of other goroutines, so RestoreOnPanic should be deferred in every
+// goroutine that may panic while the terminal is in a modified state.
+func (r *Restorer) RestoreOnPanic() {
+	if p := recover(); p != nil {
+		_ = r.Restore()
+		panic(p)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package term
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminateSignals are the signals that, by default, terminate the process
+// and after which the terminal must be restored.
+var terminateSignals = []os.Signal{unix.SIGINT, unix.SIGTERM, unix.SIGHUP}
+
+// onTerminate calls fn when the process receives one of the terminateSignals,
+// and raises the signal again afterwards, so that it is handled as if fn was
+// not installed. The returned function stops handling signals.
+func onTerminate(fn func()) (stop func()) {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, terminateSignals...)
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(done)
+		})
+	}
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			fn()
+			stop()
+			if s, ok := sig.(syscall.Signal); ok {
+				_ = unix.Kill(unix.Getpid(), s)
+			}
+		case <-done:
+		}
+	}()
+	return stop
+}
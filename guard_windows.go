@@ -0,0 +1,63 @@
+package term
+
+import (
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+var procSetConsoleCtrlHandler = windows.NewLazySystemDLL("kernel32.dll").NewProc("SetConsoleCtrlHandler")
+
+var (
+	ctrlHandlersMu   sync.Mutex
+	ctrlHandlers     = map[int]func(){}
+	ctrlHandlerID    int
+	ctrlHandlerSetup sync.Once
+	ctrlHandlerErr   error
+)
+
+// ctrlHandler is registered with SetConsoleCtrlHandler. It calls the handlers
+// registered through onTerminate, and returns FALSE so that the next handler
+// (the Go runtime's, or the system's default handler) handles the event as if
+// ctrlHandler was not installed.
+func ctrlHandler(uint32) uintptr {
+	ctrlHandlersMu.Lock()
+	handlers := make([]func(), 0, len(ctrlHandlers))
+	for _, fn := range ctrlHandlers {
+		handlers = append(handlers, fn)
+	}
+	ctrlHandlersMu.Unlock()
+
+	for _, fn := range handlers {
+		fn()
+	}
+	return 0
+}
+
+// onTerminate calls fn when the process receives a console control event
+// (Ctrl-C, Ctrl-Break, close, logoff or shutdown), without consuming the
+// event. The returned function stops handling events.
+func onTerminate(fn func()) (stop func()) {
+	ctrlHandlerSetup.Do(func() {
+		r, _, err := procSetConsoleCtrlHandler.Call(windows.NewCallback(ctrlHandler), 1)
+		if r == 0 {
+			ctrlHandlerErr = err
+		}
+	})
+	if ctrlHandlerErr != nil {
+		return func() {}
+	}
+
+	var once sync.Once
+	ctrlHandlersMu.Lock()
+	ctrlHandlerID++
+	id := ctrlHandlerID
+	ctrlHandlers[id] = func() { once.Do(fn) }
+	ctrlHandlersMu.Unlock()
+
+	return func() {
+		ctrlHandlersMu.Lock()
+		delete(ctrlHandlers, id)
+		ctrlHandlersMu.Unlock()
+	}
+}
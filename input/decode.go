@@ -0,0 +1,227 @@
+package input
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moby/term/internal/paste"
+)
+
+const esc = 0x1b
+
+// csiKeys maps the final byte of CSI and SS3 key sequences, such as the 'A'
+// of "\x1b[A", to keys.
+var csiKeys = map[byte]Key{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'H': KeyHome,
+	'F': KeyEnd,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+}
+
+// tildeKeys maps the number of "\x1b[<number>~" key sequences to keys.
+var tildeKeys = map[int]Key{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+}
+
+// Decode decodes the first event in p, and returns it with the number of
+// bytes of p it was decoded from. If p holds the start of an event that may
+// continue with more input, such as a lone ESC, which may be the Escape key or
+// the start of a key sequence, it returns zero bytes, unless flush is set, in
+// which case it decodes the bytes as they are. Callers typically set flush
+// once no more input arrived for a short time, or at the end of the input.
+func Decode(p []byte, flush bool) (Event, int) {
+	ev, n := decode(p, flush)
+	if n > 0 {
+		ev.Raw = append([]byte(nil), p[:n]...)
+	}
+	return ev, n
+}
+
+func decode(p []byte, flush bool) (Event, int) {
+	if len(p) == 0 {
+		return Event{}, 0
+	}
+	c := p[0]
+	switch {
+	case c == esc:
+		return decodeEscape(p, flush)
+	case c == '\r':
+		return Event{Type: EventKey, Key: KeyEnter}, 1
+	case c == '\t':
+		return Event{Type: EventKey, Key: KeyTab}, 1
+	case c == 0x7f || c == 0x08:
+		return Event{Type: EventKey, Key: KeyBackspace}, 1
+	case c == 0:
+		return Event{Type: EventRune, Rune: ' ', Mod: ModCtrl}, 1
+	case c < 0x1b:
+		return Event{Type: EventRune, Rune: rune('a' + c - 1), Mod: ModCtrl}, 1
+	case c < 0x20:
+		return Event{Type: EventRune, Rune: rune(c + 0x40), Mod: ModCtrl}, 1
+	case c < utf8.RuneSelf:
+		return Event{Type: EventRune, Rune: rune(c)}, 1
+	}
+	if !utf8.FullRune(p) {
+		if !flush {
+			return Event{}, 0
+		}
+		return Event{Type: EventUnknown}, len(p)
+	}
+	r, size := utf8.DecodeRune(p)
+	if r == utf8.RuneError {
+		return Event{Type: EventUnknown}, size
+	}
+	return Event{Type: EventRune, Rune: r}, size
+}
+
+// decodeEscape decodes an event that starts with ESC: the Escape key, a CSI
+// or SS3 key sequence, or a key with the alt modifier, which is sent as ESC
+// followed by the key, or as ESC, 'N' and the key by the windowsconsole
+// package. As a result, alt+'N' followed by another key is decoded as the
+// other key with the alt modifier, unless the timeout of the Decoder
+// elapses in between.
+func decodeEscape(p []byte, flush bool) (Event, int) {
+	if len(p) == 1 {
+		if !flush {
+			return Event{}, 0
+		}
+		return Event{Type: EventKey, Key: KeyEscape}, 1
+	}
+	switch p[1] {
+	case '[':
+		if ev, n := decodeCSI(p, flush); n > 0 || !flush || len(p) > 2 {
+			return ev, n
+		}
+	case 'O':
+		if len(p) > 2 {
+			if key, ok := csiKeys[p[2]]; ok {
+				return Event{Type: EventKey, Key: key}, 3
+			}
+			return Event{Type: EventUnknown}, 3
+		}
+		if !flush {
+			return Event{}, 0
+		}
+	case 'N':
+		// The windowsconsole package sends keys with the alt modifier as
+		// ESC, 'N', and the key.
+		if len(p) > 2 {
+			ev, n := decode(p[2:], flush)
+			if n == 0 {
+				return ev, 0
+			}
+			if ev.Type == EventRune || ev.Type == EventKey {
+				ev.Mod |= ModAlt
+			}
+			return ev, n + 2
+		}
+		if !flush {
+			return Event{}, 0
+		}
+	case esc:
+		return Event{Type: EventKey, Key: KeyEscape}, 1
+	}
+	ev, n := decode(p[1:], flush)
+	if n == 0 {
+		return ev, 0
+	}
+	if ev.Type == EventRune || ev.Type == EventKey {
+		ev.Mod |= ModAlt
+	}
+	return ev, n + 1
+}
+
+// decodeCSI decodes a CSI sequence, which is ESC, '[', parameter bytes,
+// intermediate bytes, and a final byte, or a bracketed paste.
+func decodeCSI(p []byte, flush bool) (Event, int) {
+	i := 2
+	for i < len(p) && p[i] >= 0x20 && p[i] <= 0x3f {
+		i++
+	}
+	if i == len(p) {
+		if !flush || i == 2 {
+			return Event{}, 0
+		}
+		return Event{Type: EventUnknown}, i
+	}
+	if p[i] < 0x40 || p[i] > 0x7e {
+		// Not a valid CSI sequence, so report the bytes up to the invalid
+		// one as unknown.
+		return Event{Type: EventUnknown}, i
+	}
+	n := i + 1
+	if bytes.HasPrefix(p, []byte(paste.Start)) {
+		return decodePaste(p, flush)
+	}
+
+	params := strings.Split(string(p[2:i]), ";")
+	ev := Event{Type: EventKey}
+	if len(params) > 1 {
+		if m, err := strconv.Atoi(params[1]); err == nil && m > 1 && m <= 16 {
+			ev.Mod = Modifier(m - 1)
+		}
+	}
+	switch final := p[i]; final {
+	case '~':
+		num, _ := strconv.Atoi(params[0])
+		key, ok := tildeKeys[num]
+		if !ok {
+			return Event{Type: EventUnknown}, n
+		}
+		ev.Key = key
+	case 'Z':
+		ev.Key, ev.Mod = KeyTab, ModShift
+	default:
+		key, ok := csiKeys[final]
+		if !ok {
+			return Event{Type: EventUnknown}, n
+		}
+		ev.Key = key
+	}
+	return ev, n
+}
+
+// decodePaste decodes text pasted in bracketed paste mode, which is sent
+// between ESC [ 200 ~ and ESC [ 201 ~.
+func decodePaste(p []byte, flush bool) (Event, int) {
+	text := p[len(paste.Start):]
+	end := bytes.Index(text, []byte(paste.End))
+	if end < 0 {
+		if !flush {
+			return Event{}, 0
+		}
+		return Event{Type: EventPaste, Paste: string(text)}, len(p)
+	}
+	return Event{Type: EventPaste, Paste: string(text[:end])}, len(paste.Start) + end + len(paste.End)
+}
+
+// inPaste reports whether p starts with a bracketed paste.
+func inPaste(p []byte) bool {
+	return bytes.HasPrefix(p, []byte(paste.Start))
+}
@@ -0,0 +1,150 @@
+package input
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/moby/term/internal/async"
+	"github.com/moby/term/internal/paste"
+)
+
+// DefaultEscapeTimeout is the default time after which a Decoder decodes a
+// lone ESC as the Escape key, if no further input arrives.
+const DefaultEscapeTimeout = 50 * time.Millisecond
+
+// ErrClosed is returned by ReadEvent once the Decoder is closed.
+var ErrClosed = errors.New("input: decoder closed")
+
+// Option configures a Decoder created by NewDecoder.
+type Option func(*Decoder)
+
+// WithEscapeTimeout sets the time after which the decoder decodes incomplete
+// input as it is, if no further input arrives. This resolves the ambiguity
+// between the Escape key, which sends a lone ESC, and key sequences, which
+// start with ESC. Bracketed pastes are not subject to the timeout; a paste
+// whose end marker is not read is decoded as it is after 1 MiB of input, or
+// once no further input arrives for half a second.
+func WithEscapeTimeout(timeout time.Duration) Option {
+	return func(d *Decoder) {
+		d.timeout = timeout
+	}
+}
+
+// Decoder reads input events from a reader.
+type Decoder struct {
+	r       io.Reader
+	timeout time.Duration
+
+	// buf holds the input that was read, but not decoded yet.
+	buf []byte
+	// err is the error that the reader returned, once buf is decoded.
+	err error
+
+	results chan async.Result
+	// done is closed by Close, to stop the goroutine reading from r.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDecoder returns a Decoder that reads input from r, such as a terminal in
+// raw mode.
+//
+// The reader is read from in a separate goroutine, which is started by the
+// first call to ReadEvent. Call Close once the Decoder is no longer used.
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	d := &Decoder{
+		r:       r,
+		timeout: DefaultEscapeTimeout,
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// ReadEvent reads the next input event. Once the reader returns an error, and
+// all input read before it is decoded, it returns that error. Once the Decoder
+// is closed, it returns ErrClosed. ReadEvent must not be called concurrently,
+// but it may be called concurrently with Close.
+func (d *Decoder) ReadEvent() (Event, error) {
+	select {
+	case <-d.done:
+		return Event{}, ErrClosed
+	default:
+	}
+	if d.results == nil {
+		d.results = make(chan async.Result)
+		go async.ReadLoop(d.r, 1024, d.results, d.done)
+	}
+	for {
+		if len(d.buf) > 0 {
+			if ev, n := Decode(d.buf, d.err != nil); n > 0 {
+				d.buf = d.buf[:copy(d.buf, d.buf[n:])]
+				return ev, nil
+			}
+			if n := len(paste.Start) + paste.MaxLen; inPaste(d.buf) && len(d.buf) >= n {
+				// The end marker of the paste was not read, so the paste
+				// is considered over, and what follows is decoded again.
+				return d.flush(n), nil
+			}
+		}
+		if d.err != nil {
+			return Event{}, d.err
+		}
+
+		ok, err := d.wait()
+		if err != nil {
+			return Event{}, err
+		}
+		if !ok {
+			return d.flush(len(d.buf)), nil
+		}
+	}
+}
+
+// flush decodes the first n bytes of the buffer as they are.
+func (d *Decoder) flush(n int) Event {
+	ev, n := Decode(d.buf[:n], true)
+	d.buf = d.buf[:copy(d.buf, d.buf[n:])]
+	return ev
+}
+
+// wait waits for input, and reports whether it arrived before the timeout. The
+// timeout only applies to incomplete input, and is the escape timeout, or
+// paste.IdleTimeout for a paste whose end marker was not read yet. It returns
+// ErrClosed if the Decoder is closed while waiting.
+func (d *Decoder) wait() (bool, error) {
+	var timeout <-chan time.Time
+	if len(d.buf) > 0 {
+		wait := d.timeout
+		if inPaste(d.buf) {
+			wait = paste.IdleTimeout
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case res := <-d.results:
+		d.buf = append(d.buf, res.Data...)
+		d.err = res.Err
+		return true, nil
+	case <-timeout:
+		return false, nil
+	case <-d.done:
+		return false, ErrClosed
+	}
+}
+
+// Close stops the Decoder. It does not close the reader; the goroutine
+// reading from it exits once its pending read returns. Close is safe to call
+// multiple times.
+func (d *Decoder) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.done)
+	})
+	return nil
+}
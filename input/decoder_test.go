@@ -0,0 +1,187 @@
+package input
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moby/term/internal/paste"
+)
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		input    string
+		flush    bool
+		expected Event
+		n        int
+	}{
+		{name: "rune", input: "ab", expected: Event{Type: EventRune, Rune: 'a'}, n: 1},
+		{name: "utf-8", input: "é", expected: Event{Type: EventRune, Rune: 'é'}, n: 2},
+		{name: "incomplete utf-8", input: "\xc3", n: 0},
+		{name: "invalid utf-8", input: "\xff", expected: Event{Type: EventUnknown}, n: 1},
+		{name: "ctrl", input: "\x10", expected: Event{Type: EventRune, Rune: 'p', Mod: ModCtrl}, n: 1},
+		{name: "ctrl-\\", input: "\x1c", expected: Event{Type: EventRune, Rune: '\\', Mod: ModCtrl}, n: 1},
+		{name: "enter", input: "\r", expected: Event{Type: EventKey, Key: KeyEnter}, n: 1},
+		{name: "backspace", input: "\x7f", expected: Event{Type: EventKey, Key: KeyBackspace}, n: 1},
+		{name: "lone escape", input: "\x1b", n: 0},
+		{name: "lone escape flushed", input: "\x1b", flush: true, expected: Event{Type: EventKey, Key: KeyEscape}, n: 1},
+		{name: "alt", input: "\x1bx", expected: Event{Type: EventRune, Rune: 'x', Mod: ModAlt}, n: 2},
+		{name: "windows alt", input: "\x1bNx", expected: Event{Type: EventRune, Rune: 'x', Mod: ModAlt}, n: 3},
+		{name: "windows alt-ctrl", input: "\x1bN\x10", expected: Event{Type: EventRune, Rune: 'p', Mod: ModCtrl | ModAlt}, n: 3},
+		{name: "windows alt incomplete", input: "\x1bN", n: 0},
+		{name: "alt-N flushed", input: "\x1bN", flush: true, expected: Event{Type: EventRune, Rune: 'N', Mod: ModAlt}, n: 2},
+		{name: "alt-[ flushed", input: "\x1b[", flush: true, expected: Event{Type: EventRune, Rune: '[', Mod: ModAlt}, n: 2},
+		{name: "up", input: "\x1b[A", expected: Event{Type: EventKey, Key: KeyUp}, n: 3},
+		{name: "ss3 up", input: "\x1bOA", expected: Event{Type: EventKey, Key: KeyUp}, n: 3},
+		{name: "ss3 f1", input: "\x1bOP", expected: Event{Type: EventKey, Key: KeyF1}, n: 3},
+		{name: "ctrl-up", input: "\x1b[1;5A", expected: Event{Type: EventKey, Key: KeyUp, Mod: ModCtrl}, n: 6},
+		{name: "windows ctrl-up", input: "\x1b[;5A", expected: Event{Type: EventKey, Key: KeyUp, Mod: ModCtrl}, n: 5},
+		{name: "shift-alt-ctrl-left", input: "\x1b[1;8D", expected: Event{Type: EventKey, Key: KeyLeft, Mod: ModShift | ModAlt | ModCtrl}, n: 6},
+		{name: "f5", input: "\x1b[15~", expected: Event{Type: EventKey, Key: KeyF5}, n: 5},
+		{name: "shift-f5", input: "\x1b[15;2~", expected: Event{Type: EventKey, Key: KeyF5, Mod: ModShift}, n: 7},
+		{name: "page down", input: "\x1b[6~", expected: Event{Type: EventKey, Key: KeyPageDown}, n: 4},
+		{name: "backtab", input: "\x1b[Z", expected: Event{Type: EventKey, Key: KeyTab, Mod: ModShift}, n: 3},
+		{name: "incomplete csi", input: "\x1b[1;5", n: 0},
+		{name: "unknown csi", input: "\x1b[99~x", expected: Event{Type: EventUnknown}, n: 5},
+		{name: "paste", input: "\x1b[200~a\x1b[Ab\x1b[201~c", expected: Event{Type: EventPaste, Paste: "a\x1b[Ab"}, n: 17},
+		{name: "incomplete paste", input: "\x1b[200~ab", n: 0},
+		{name: "incomplete paste flushed", input: "\x1b[200~ab", flush: true, expected: Event{Type: EventPaste, Paste: "ab"}, n: 8},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ev, n := Decode([]byte(tc.input), tc.flush)
+			if n != tc.n {
+				t.Fatalf("expected: %d, got: %d", tc.n, n)
+			}
+			if n == 0 {
+				return
+			}
+			if expected := []byte(tc.input[:n]); !bytes.Equal(ev.Raw, expected) {
+				t.Errorf("expected: %q, got: %q", expected, ev.Raw)
+			}
+			ev.Raw = nil
+			if !reflect.DeepEqual(ev, tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, ev)
+			}
+		})
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	d := NewDecoder(pr, WithEscapeTimeout(20*time.Millisecond))
+
+	go func() {
+		_, _ = pw.Write([]byte("a\x1b[1;5"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = pw.Write([]byte("A\x1b"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = pw.Write([]byte("\x1b[200~x"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = pw.Write([]byte("y\x1b[201~"))
+		_ = pw.Close()
+	}()
+
+	var events []string
+	for {
+		ev, err := d.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev.String())
+	}
+	expected := []string{`'a'`, "unknown \"\\x1b[1;5\"", `'A'`, "Escape", `paste "xy"`}
+	if len(events) != len(expected) {
+		t.Fatalf("expected: %q, got: %q", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("expected: %q, got: %q", expected[i], events[i])
+		}
+	}
+}
+
+func TestDecoderUnterminatedPaste(t *testing.T) {
+	t.Run("idle", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		d := NewDecoder(pr)
+		defer d.Close()
+
+		go func() {
+			_, _ = pw.Write([]byte("\x1b[200~abc"))
+			time.Sleep(paste.IdleTimeout + 100*time.Millisecond)
+			_, _ = pw.Write([]byte("x"))
+		}()
+		for _, expected := range []string{`paste "abc"`, `'x'`} {
+			ev, err := d.ReadEvent()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.String() != expected {
+				t.Errorf("expected: %q, got: %q", expected, ev.String())
+			}
+		}
+	})
+
+	t.Run("length", func(t *testing.T) {
+		text := strings.Repeat("a", paste.MaxLen)
+		d := NewDecoder(strings.NewReader(paste.Start + text + "x"))
+		defer d.Close()
+
+		ev, err := d.ReadEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Type != EventPaste || ev.Paste != text {
+			t.Errorf("expected a paste of %d bytes, got: %v with %d bytes", len(text), ev.Type, len(ev.Paste))
+		}
+		if ev, err = d.ReadEvent(); err != nil || ev.String() != `'x'` {
+			t.Errorf("expected: %q, got: %q, %v", `'x'`, ev.String(), err)
+		}
+	})
+}
+
+func TestDecoderClose(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	d := NewDecoder(pr)
+
+	go func() {
+		_, _ = pw.Write([]byte("a"))
+	}()
+	if _, err := d.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() {
+		_ = d.Close()
+	})
+	if _, err := d.ReadEvent(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected: %v, got: %v", ErrClosed, err)
+	}
+
+	// The reading goroutine does not block once its pending read returns.
+	done := make(chan struct{})
+	go func() {
+		_, _ = pw.Write([]byte("b"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the pending read to complete")
+	}
+	if _, err := d.ReadEvent(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected: %v, got: %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,146 @@
+// Package input decodes the input of a terminal in raw mode into key events,
+// such as the input read from a terminal after calling term.SetRawTerminal.
+// It understands the sequences sent by xterm-compatible terminals, and by the
+// Windows console with virtual terminal input enabled, or translated by the
+// windowsconsole package.
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EventType is the type of an input Event.
+type EventType int
+
+const (
+	// EventRune is a character, possibly with modifiers, such as 'a' or
+	// ctrl+'c'.
+	EventRune EventType = iota
+	// EventKey is a named key, such as KeyUp or KeyF5, possibly with
+	// modifiers.
+	EventKey
+	// EventPaste is text pasted in bracketed paste mode.
+	EventPaste
+	// EventUnknown is a sequence that could not be decoded.
+	EventUnknown
+)
+
+// Key is a named key.
+type Key int
+
+// Named keys.
+const (
+	KeyNone Key = iota
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEscape
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+)
+
+var keyNames = map[Key]string{
+	KeyEnter:     "Enter",
+	KeyTab:       "Tab",
+	KeyBackspace: "Backspace",
+	KeyEscape:    "Escape",
+	KeyUp:        "Up",
+	KeyDown:      "Down",
+	KeyRight:     "Right",
+	KeyLeft:      "Left",
+	KeyHome:      "Home",
+	KeyEnd:       "End",
+	KeyInsert:    "Insert",
+	KeyDelete:    "Delete",
+	KeyPageUp:    "PageUp",
+	KeyPageDown:  "PageDown",
+}
+
+func (k Key) String() string {
+	if name, ok := keyNames[k]; ok {
+		return name
+	}
+	if k >= KeyF1 && k <= KeyF12 {
+		return fmt.Sprintf("F%d", k-KeyF1+1)
+	}
+	return "None"
+}
+
+// Modifier is a set of modifier keys held while a key is pressed.
+type Modifier uint8
+
+// Modifier keys. Their values match the bits of the modifier parameter of
+// xterm key sequences, minus one; for example, ";6" is ModShift|ModCtrl.
+const (
+	ModShift Modifier = 1 << iota
+	ModAlt
+	ModCtrl
+)
+
+func (m Modifier) String() string {
+	var names []string
+	if m&ModCtrl != 0 {
+		names = append(names, "ctrl")
+	}
+	if m&ModAlt != 0 {
+		names = append(names, "alt")
+	}
+	if m&ModShift != 0 {
+		names = append(names, "shift")
+	}
+	return strings.Join(names, "+")
+}
+
+// Event is an input event.
+type Event struct {
+	Type EventType
+	// Rune is the character of an EventRune.
+	Rune rune
+	// Key is the key of an EventKey.
+	Key Key
+	// Mod holds the modifiers of an EventRune or EventKey.
+	Mod Modifier
+	// Paste holds the text of an EventPaste.
+	Paste string
+	// Raw holds the bytes the event was decoded from.
+	Raw []byte
+}
+
+func (e Event) String() string {
+	var s string
+	switch e.Type {
+	case EventRune:
+		s = fmt.Sprintf("%q", e.Rune)
+	case EventKey:
+		s = e.Key.String()
+	case EventPaste:
+		return fmt.Sprintf("paste %q", e.Paste)
+	default:
+		return fmt.Sprintf("unknown %q", e.Raw)
+	}
+	if e.Mod != 0 {
+		return e.Mod.String() + "+" + s
+	}
+	return s
+}
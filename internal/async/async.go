@@ -0,0 +1,32 @@
+// Package async reads from an io.Reader in a separate goroutine, so that
+// waiting for input from readers that cannot be polled can be combined with
+// timeouts and cancellation.
+package async
+
+import "io"
+
+// Result is the result of a read.
+type Result struct {
+	Data []byte
+	Err  error
+}
+
+// ReadLoop reads from r, with a buffer of the given size, and sends the result
+// of each read to results, until r returns an error, or done is closed. It is
+// meant to run in its own goroutine, which remains blocked reading from r until
+// input arrives, or r is closed, so closing done only stops it once its pending
+// read returns.
+func ReadLoop(r io.Reader, size int, results chan<- Result, done <-chan struct{}) {
+	buf := make([]byte, size)
+	for {
+		n, err := r.Read(buf)
+		select {
+		case results <- Result{Data: append([]byte(nil), buf[:n]...), Err: err}:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Package paste holds the markers of bracketed pastes, and the limits after
+// which a paste whose end marker was not read is considered over, so that the
+// escape proxy and the input decoder handle pastes in the same way.
+package paste
+
+import "time"
+
+const (
+	// Start is the marker that the terminal sends before pasted text.
+	Start = "\x1b[200~"
+	// End is the marker that the terminal sends after pasted text.
+	End = "\x1b[201~"
+
+	// MaxLen is the number of bytes after which a paste whose end marker was
+	// not read is considered over, so that a truncated paste, or a stray start
+	// marker, does not disable escape detection for good.
+	MaxLen = 1 << 20
+	// IdleTimeout is the time spent waiting for input after which a paste
+	// whose end marker was not read is considered over. Terminals send pasted
+	// text at once, so pauses in the middle of a paste are short.
+	IdleTimeout = 500 * time.Millisecond
+)
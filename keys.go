@@ -0,0 +1,197 @@
+package term
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Key is a key, as sent by a terminal. Most keys send a single byte, such as
+// 0x10 for ctrl-p, but some send several, such as alt-x, which sends ESC
+// followed by 'x'. The zero value is not a valid key.
+type Key struct {
+	code string
+}
+
+// ParseKey parses a key in one of the forms accepted by [ToBytes], such as
+// "ctrl-p", "^P", "esc", "alt-x" or "0x10".
+func ParseKey(s string) (Key, error) {
+	code, err := keyBytes(s)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{code: string(code)}, nil
+}
+
+// Bytes returns the bytes that the key sends.
+func (k Key) Bytes() []byte {
+	return []byte(k.code)
+}
+
+// String returns the canonical name of the key, as accepted by [ParseKey],
+// such as "ctrl-p" or "alt-x".
+func (k Key) String() string {
+	if len(k.code) == 1 {
+		c := k.code[0]
+		if c == ',' || c > 127 {
+			return fmt.Sprintf("0x%02x", c)
+		}
+		return keyName(c)
+	}
+	if r, size := utf8.DecodeRuneInString(k.code); size == len(k.code) && r != utf8.RuneError {
+		return k.code
+	}
+	if len(k.code) > 1 && k.code[0] == 27 {
+		return "alt-" + Key{code: k.code[1:]}.String()
+	}
+	return ""
+}
+
+// Equal reports whether k and other send the same bytes.
+func (k Key) Equal(other Key) bool {
+	return k.code == other.code
+}
+
+// MarshalText implements [encoding.TextMarshaler]. It returns the canonical
+// name of the key.
+func (k Key) MarshalText() ([]byte, error) {
+	if k.code == "" {
+		return nil, errors.New("empty key")
+	}
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler]. It parses the key
+// like [ParseKey].
+func (k *Key) UnmarshalText(text []byte) error {
+	key, err := ParseKey(string(text))
+	if err != nil {
+		return err
+	}
+	*k = key
+	return nil
+}
+
+// printable reports whether the key sends a single printable character.
+func (k Key) printable() bool {
+	r, size := utf8.DecodeRuneInString(k.code)
+	return size == len(k.code) && r != utf8.RuneError && unicode.IsPrint(r)
+}
+
+// KeySequence is a sequence of keys, such as a detach key sequence.
+type KeySequence []Key
+
+// ParseKeySequence parses a comma-separated sequence of keys, such as
+// "ctrl-p,ctrl-q", in the form accepted by [ToBytes].
+func ParseKeySequence(s string) (KeySequence, error) {
+	names := strings.Split(s, ",")
+	seq := make(KeySequence, 0, len(names))
+	for _, name := range names {
+		key, err := ParseKey(name)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, key)
+	}
+	return seq, nil
+}
+
+// keySequenceFromBytes splits codes into the keys that send them. ESC followed
+// by another key is the alt- variant of that key, and the bytes of a UTF-8
+// character are a single key. Any other byte is a key of its own.
+func keySequenceFromBytes(codes []byte) KeySequence {
+	seq := KeySequence{}
+	for len(codes) > 0 {
+		n := keyLen(codes)
+		if codes[0] == 27 && len(codes) > 1 && codes[1] != 27 {
+			n = 1 + keyLen(codes[1:])
+		}
+		seq = append(seq, Key{code: string(codes[:n])})
+		codes = codes[n:]
+	}
+	return seq
+}
+
+// keyLen returns the number of bytes of the key at the start of codes.
+func keyLen(codes []byte) int {
+	if r, size := utf8.DecodeRune(codes); r != utf8.RuneError {
+		return size
+	}
+	return 1
+}
+
+// Bytes returns the bytes that the keys of the sequence send.
+func (s KeySequence) Bytes() []byte {
+	codes := []byte{}
+	for _, key := range s {
+		codes = append(codes, key.code...)
+	}
+	return codes
+}
+
+// String returns the canonical form of the sequence, as accepted by
+// [ParseKeySequence], such as "ctrl-p,ctrl-q".
+func (s KeySequence) String() string {
+	names := make([]string, 0, len(s))
+	for _, key := range s {
+		names = append(names, key.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// Equal reports whether s and other consist of the same keys.
+func (s KeySequence) Equal(other KeySequence) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for i := range s {
+		if !s[i].Equal(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate reports whether the sequence is usable as an escape sequence, such
+// as a detach key sequence. It returns an error if the sequence is empty, or
+// if it is a single printable key, which would be detected whenever the key
+// is typed as regular input.
+func (s KeySequence) Validate() error {
+	switch {
+	case len(s) == 0:
+		return errors.New("empty key sequence")
+	case len(s) == 1 && s[0].printable():
+		return fmt.Errorf("invalid key sequence %q: a single printable key cannot be used as an escape sequence", s.String())
+	}
+	for _, key := range s {
+		if key.code == "" {
+			return fmt.Errorf("invalid key sequence %q: empty key", s.String())
+		}
+	}
+	return nil
+}
+
+// MarshalText implements [encoding.TextMarshaler]. It returns the canonical
+// form of the sequence.
+func (s KeySequence) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler]. It parses the
+// sequence like [ParseKeySequence], except that empty text is parsed as an
+// empty sequence. It does not validate the sequence; use
+// [KeySequence.Validate] to do so.
+func (s *KeySequence) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*s = nil
+		return nil
+	}
+	seq, err := ParseKeySequence(string(text))
+	if err != nil {
+		return err
+	}
+	*s = seq
+	return nil
+}
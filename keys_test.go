@@ -0,0 +1,112 @@
+package term
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		expected string
+		code     []byte
+	}{
+		{name: "ctrl-p", expected: "ctrl-p", code: []byte{16}},
+		{name: "^P", expected: "ctrl-p", code: []byte{16}},
+		{name: "esc", expected: "ctrl-[", code: []byte{27}},
+		{name: "del", expected: "DEL", code: []byte{127}},
+		{name: "Alt-X", expected: "alt-X", code: []byte{27, 'X'}},
+		{name: "0x2c", expected: "0x2c", code: []byte{','}},
+		{name: "0xff", expected: "0xff", code: []byte{255}},
+		{name: "é", expected: "é", code: []byte{0xc3, 0xa9}},
+	} {
+		key, err := ParseKey(tc.name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(key.Bytes(), tc.code) {
+			t.Errorf("expected: %+v, got: %+v", tc.code, key.Bytes())
+		}
+		if key.String() != tc.expected {
+			t.Errorf("expected: %q, got: %q", tc.expected, key.String())
+		}
+		parsed, err := ParseKey(key.String())
+		if err != nil {
+			t.Error(err)
+		} else if !parsed.Equal(key) {
+			t.Errorf("expected: %v, got: %v", key, parsed)
+		}
+	}
+
+	if _, err := ParseKey("shift-z"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestKeySequence(t *testing.T) {
+	seq, err := ParseKeySequence("Ctrl-P,^Q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "ctrl-p,ctrl-q"; seq.String() != expected {
+		t.Errorf("expected: %q, got: %q", expected, seq.String())
+	}
+	if expected := []byte{16, 17}; !bytes.Equal(seq.Bytes(), expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, seq.Bytes())
+	}
+	other, _ := ParseKeySequence("ctrl-p,ctrl-q")
+	if !seq.Equal(other) {
+		t.Errorf("expected %v to equal %v", seq, other)
+	}
+	other, _ = ParseKeySequence("ctrl-p")
+	if seq.Equal(other) {
+		t.Errorf("expected %v not to equal %v", seq, other)
+	}
+
+	var config struct {
+		DetachKeys KeySequence `json:"detachKeys"`
+	}
+	if err := json.Unmarshal([]byte(`{"detachKeys":"ctrl-a,Alt-x"}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"detachKeys":"ctrl-a,alt-x"}`; string(out) != expected {
+		t.Errorf("expected: %s, got: %s", expected, out)
+	}
+	if err := json.Unmarshal([]byte(`{"detachKeys":"ctrl-a,shift-z"}`), &config); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestKeySequenceValidate(t *testing.T) {
+	for _, tc := range []struct {
+		keys  string
+		valid bool
+	}{
+		{keys: "", valid: false},
+		{keys: "a", valid: false},
+		{keys: "space", valid: false},
+		{keys: "é", valid: false},
+		{keys: "ctrl-p", valid: true},
+		{keys: "alt-a", valid: true},
+		{keys: "a,b", valid: true},
+		{keys: "ctrl-p,ctrl-q", valid: true},
+	} {
+		var seq KeySequence
+		if err := seq.UnmarshalText([]byte(tc.keys)); err != nil {
+			t.Fatal(err)
+		}
+		err := seq.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("expected %q to be valid, got: %v", tc.keys, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("expected %q to be invalid", tc.keys)
+		}
+	}
+}
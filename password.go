@@ -0,0 +1,183 @@
+package term
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// InterruptError is returned by [ReadPassword] and [PromptSecret] when the
+// user interrupts the input by pressing Ctrl-C.
+type InterruptError struct{}
+
+func (InterruptError) Error() string {
+	return "interrupted"
+}
+
+// ReadPassword reads a line of input from the terminal connected to the given
+// file descriptor, without echoing it, and returns it without the line
+// terminator.
+//
+// While reading, the terminal is put into a mode where echo, line editing and
+// signal generation are disabled, and restored to its previous state before
+// ReadPassword returns. Line editing is emulated: backspace deletes the last
+// character, and Ctrl-U deletes the whole line. Ctrl-C returns an
+// [InterruptError], and Ctrl-D on an empty line returns [io.EOF].
+func ReadPassword(fd uintptr) ([]byte, error) {
+	return readSecret(fd, fdReader(fd))
+}
+
+// PromptSecret writes prompt to out, reads a line of input from in without
+// echoing it, and then writes a newline to out, as the line terminator typed
+// by the user is not echoed either.
+//
+// If in is a terminal, as reported by [GetFdInfo], it is handled as described
+// for [ReadPassword]. This includes the emulated console input returned by
+// [StdStreams] on Windows. Otherwise, for example if input is piped into the
+// process, a line is read from in literally, up to a newline, without
+// consuming any further input. Control characters are kept as they are, and
+// only a carriage return right before the newline is removed.
+func PromptSecret(in io.Reader, out io.Writer, prompt string) ([]byte, error) {
+	if _, err := io.WriteString(out, prompt); err != nil {
+		return nil, err
+	}
+
+	var (
+		secret []byte
+		err    error
+	)
+	if fd, isTerm := GetFdInfo(in); isTerm {
+		secret, err = readSecret(fd, in)
+	} else {
+		secret, err = readRawLine(in)
+	}
+	if _, werr := io.WriteString(out, "\n"); werr != nil && err == nil {
+		err = werr
+	}
+	return secret, err
+}
+
+// readSecret reads a line from r, which reads from the terminal connected to
+// fd, with echo, line editing and signal generation disabled.
+func readSecret(fd uintptr, r io.Reader) ([]byte, error) {
+	state, err := MakeRawWithOptions(fd, WithOutputProcessing())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = RestoreTerminal(fd, state)
+	}()
+	return readLine(r)
+}
+
+// Control characters handled by readLine.
+const (
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyBackspace = 0x08
+	keyCtrlU     = 0x15
+	keyDelete    = 0x7f
+)
+
+// readLine reads a line from r, one byte at a time so that no input past the
+// end of the line is consumed, emulating line editing.
+func readLine(r io.Reader) ([]byte, error) {
+	var (
+		line []byte
+		buf  [1]byte
+	)
+	for {
+		n, err := r.Read(buf[:])
+		if n > 0 {
+			switch c := buf[0]; c {
+			case '\r', '\n':
+				return line, nil
+			case keyBackspace, keyDelete:
+				if len(line) > 0 {
+					_, size := utf8.DecodeLastRune(line)
+					zero(line[len(line)-size:])
+					line = line[:len(line)-size]
+				}
+			case keyCtrlU:
+				zero(line)
+				line = line[:0]
+			case keyCtrlC:
+				zero(line)
+				return nil, InterruptError{}
+			case keyCtrlD:
+				if len(line) == 0 {
+					return nil, io.EOF
+				}
+			default:
+				line = appendSecret(line, c)
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				return line, nil
+			}
+			zero(line)
+			return nil, err
+		}
+	}
+}
+
+// readRawLine reads a line from r, one byte at a time so that no input past
+// the end of the line is consumed. Unlike readLine, it does not emulate line
+// editing, and only ends the line at a newline, removing one carriage return
+// before it.
+func readRawLine(r io.Reader) ([]byte, error) {
+	var (
+		line []byte
+		buf  [1]byte
+	)
+	for {
+		n, err := r.Read(buf[:])
+		if n > 0 {
+			if buf[0] == '\n' {
+				return bytes.TrimSuffix(line, []byte{'\r'}), nil
+			}
+			line = appendSecret(line, buf[0])
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				return bytes.TrimSuffix(line, []byte{'\r'}), nil
+			}
+			zero(line)
+			return nil, err
+		}
+	}
+}
+
+// appendSecret appends c to line like append, but when line has to grow, it
+// overwrites the previous backing array with zeros, so that no copy of the
+// input is left behind in memory.
+func appendSecret(line []byte, c byte) []byte {
+	if len(line) < cap(line) {
+		return append(line, c)
+	}
+	grown := make([]byte, len(line), 2*cap(line)+64)
+	copy(grown, line)
+	zero(line)
+	return append(grown, c)
+}
+
+// zero overwrites b with zeros, so that discarded input does not linger in
+// memory.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// fdReader is an [io.Reader] that reads directly from a file descriptor.
+type fdReader uintptr
+
+func (fd fdReader) Read(p []byte) (int, error) {
+	n, err := readFd(uintptr(fd), p)
+	if n == 0 && err == nil && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, err
+}
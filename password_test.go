@@ -0,0 +1,92 @@
+package term
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPromptSecret(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		input     string
+		expected  string
+		remaining string
+		err       error
+	}{
+		{name: "line", input: "secret\nmore", expected: "secret", remaining: "more"},
+		{name: "crlf", input: "pw1\r\npw2\r\n", expected: "pw1", remaining: "pw2\r\n"},
+		{name: "carriage return only", input: "sec\rret\n", expected: "sec\rret"},
+		{name: "control characters", input: "p\x7fw\x08\x15\x03\x04\n", expected: "p\x7fw\x08\x15\x03\x04"},
+		{name: "eof", input: "secret", expected: "secret"},
+		{name: "eof after carriage return", input: "secret\r", expected: "secret"},
+		{name: "empty", input: "", err: io.EOF},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			in := strings.NewReader(tc.input)
+			var out bytes.Buffer
+			secret, err := PromptSecret(in, &out, "Password: ")
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected error: %v, got: %v", tc.err, err)
+			}
+			if string(secret) != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, secret)
+			}
+			if expected := "Password: \n"; out.String() != expected {
+				t.Errorf("expected output: %q, got: %q", expected, out.String())
+			}
+			if remaining, _ := io.ReadAll(in); string(remaining) != tc.remaining {
+				t.Errorf("expected remaining input: %q, got: %q", tc.remaining, remaining)
+			}
+		})
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		input     string
+		expected  string
+		remaining string
+		err       error
+	}{
+		{name: "line", input: "secret\nmore", expected: "secret", remaining: "more"},
+		{name: "carriage return", input: "secret\r", expected: "secret"},
+		{name: "backspace", input: "secrex\x7ft\x08\x08et\n", expected: "secret"},
+		{name: "backspace multi-byte", input: "sécré\x08e\n", expected: "sécre"},
+		{name: "ctrl-u", input: "wrong\x15secret\n", expected: "secret"},
+		{name: "ctrl-c", input: "sec\x03ret\n", remaining: "ret\n", err: InterruptError{}},
+		{name: "ctrl-d", input: "\x04secret\n", remaining: "secret\n", err: io.EOF},
+		{name: "eof", input: "secret", expected: "secret"},
+		{name: "empty", input: "", err: io.EOF},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			in := strings.NewReader(tc.input)
+			line, err := readLine(in)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected error: %v, got: %v", tc.err, err)
+			}
+			if string(line) != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, line)
+			}
+			if remaining, _ := io.ReadAll(in); string(remaining) != tc.remaining {
+				t.Errorf("expected remaining input: %q, got: %q", tc.remaining, remaining)
+			}
+		})
+	}
+}
+
+func TestAppendSecret(t *testing.T) {
+	prev := []byte("sec")
+	line := appendSecret(prev[:len(prev):len(prev)], 'r')
+	if expected := "secr"; string(line) != expected {
+		t.Errorf("expected: %q, got: %q", expected, line)
+	}
+	if expected := []byte{0, 0, 0}; !bytes.Equal(prev, expected) {
+		t.Errorf("expected the previous backing array to be zeroed, got: %q", prev)
+	}
+}
@@ -0,0 +1,54 @@
+package term
+
+import "io"
+
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+)
+
+// EnableBracketedPaste enables bracketed paste mode on the terminal connected
+// to the given file descriptor. In this mode, the terminal sends pasted text
+// between ESC [ 200 ~ and ESC [ 201 ~, which lets applications tell pasted
+// text from typed keys. The file descriptor must be writable, such as the
+// terminal's output; on Windows, it must have virtual terminal processing
+// enabled.
+//
+// It returns the current state of the terminal. Restoring it with
+// [RestoreTerminal] disables bracketed paste mode again, as does
+// [RestoreAll].
+func EnableBracketedPaste(fd uintptr) (*State, error) {
+	state, err := saveState(fd)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeString(fd, bracketedPasteOn); err != nil {
+		return nil, err
+	}
+	modified.trackPaste(fd)
+	state.bracketedPaste = true
+	return state, nil
+}
+
+// DisableBracketedPaste disables bracketed paste mode on the terminal
+// connected to the given file descriptor.
+func DisableBracketedPaste(fd uintptr) error {
+	if err := disableBracketedPaste(fd); err != nil {
+		return err
+	}
+	modified.untrackPaste(fd)
+	return nil
+}
+
+func disableBracketedPaste(fd uintptr) error {
+	return writeString(fd, bracketedPasteOff)
+}
+
+// writeString writes s to the file descriptor.
+func writeString(fd uintptr, s string) error {
+	n, err := writeFd(fd, []byte(s))
+	if err == nil && n != len(s) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
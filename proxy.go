@@ -1,25 +1,234 @@
 package term
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/moby/term/internal/paste"
 )
 
 // EscapeError is special error which returned by a TTY proxy reader's Read()
 // method in case its detach escape sequence is read.
-type EscapeError struct{}
+type EscapeError struct {
+	// Name is the name of the escape sequence that was read, as passed to
+	// [WithEscapeSequence]. It is empty for proxies created with
+	// [NewEscapeProxy].
+	Name string
+	// Keys holds the bytes of the escape sequence that was read. These bytes
+	// are consumed by the proxy, and not returned to the caller. It is empty
+	// for proxies created with [NewEscapeProxy].
+	Keys string
+}
+
+func (e EscapeError) Error() string {
+	if e.Name == "" {
+		return "read escape sequence"
+	}
+	return "read escape sequence " + strconv.Quote(e.Name)
+}
+
+// EscapeOption configures a proxy created by [NewEscapeProxyWithOptions].
+type EscapeOption func(*escapeOptions)
+
+type escapeOptions struct {
+	sequences  []escapeSequence
+	lineEscape *lineEscape
+	timeout    time.Duration
+	quote      []byte
+	ctx        context.Context
+	hooks      *EscapeHooks
+	stats      *EscapeStats
+	noPaste    bool
+}
+
+// WithEscapeSequence adds an escape sequence to detect. When the sequence is
+// read, the proxy returns an [EscapeError] with the given name. If several
+// sequences match, the one that was added first is reported.
+func WithEscapeSequence(name string, keys []byte) EscapeOption {
+	return func(o *escapeOptions) {
+		o.sequences = append(o.sequences, escapeSequence{
+			name: name,
+			keys: append([]byte(nil), keys...),
+		})
+	}
+}
+
+// WithLineStartEscape enables escapes in the style of OpenSSH's "~" escapes.
+// The prefix is only recognized at the start of the input, and right after a
+// newline (CR or LF). When it is followed by one of the given command keys,
+// the proxy returns an [EscapeError] with the name of the command key, such
+// as "." or "ctrl-z", and with the prefix and the command key as its keys.
+// Typing the prefix twice sends a single prefix, and typing the prefix
+// followed by any other key sends both keys.
+//
+// If no command keys are given, the commands are '.', '?', ctrl-z and '#',
+// as in OpenSSH.
+func WithLineStartEscape(prefix byte, commands ...byte) EscapeOption {
+	if len(commands) == 0 {
+		commands = []byte{'.', '?', 0x1a, '#'}
+	}
+	return func(o *escapeOptions) {
+		o.lineEscape = &lineEscape{
+			prefix:   prefix,
+			commands: append([]byte(nil), commands...),
+		}
+	}
+}
+
+// WithEscapeQuote sets the keys that quote an escape sequence. When the quote
+// keys are immediately followed by an escape sequence, the escape sequence is
+// returned to the caller as regular input instead of being detected, and the
+// quote keys are discarded. When they are followed by anything else, they are
+// returned as regular input.
+//
+// The quote keys may be the first key of an escape sequence, in which case
+// typing that key twice, followed by the rest of the escape sequence, sends
+// the escape sequence. For example, with the escape sequence ctrl-p,ctrl-q
+// and the quote key ctrl-p, typing ctrl-p,ctrl-p,ctrl-q sends ctrl-p,ctrl-q.
+func WithEscapeQuote(quote []byte) EscapeOption {
+	return func(o *escapeOptions) {
+		o.quote = append([]byte(nil), quote...)
+	}
+}
+
+// WithEscapeTimeout sets the time after which a partially read escape sequence
+// is returned to the caller, if no further input arrives. By default, the
+// proxy waits indefinitely for the rest of the escape sequence before it
+// returns the bytes that turned out not to be one, so that typing the first
+// key of an escape sequence and then waiting appears to do nothing.
+//
+// If the wrapped reader is a terminal (it has an Fd method, and the file
+// descriptor is a terminal), it is polled for input. Otherwise, if it is an
+// [*os.File] that supports read deadlines, they are used. Otherwise, it is
+// read from in a separate goroutine, which remains blocked reading from it
+// until input arrives, or the reader is closed.
+func WithEscapeTimeout(d time.Duration) EscapeOption {
+	return func(o *escapeOptions) {
+		o.timeout = d
+	}
+}
 
-func (EscapeError) Error() string {
-	return "read escape sequence"
+// WithBracketedPaste sets whether the proxy recognizes text pasted in
+// bracketed paste mode (see [EnableBracketedPaste]), which it does by default.
+// Pasted text, which the terminal sends between ESC [ 200 ~ and ESC [ 201 ~,
+// is returned to the caller as it is, so that escape sequences within it,
+// which are usually pasted by mistake, are not detected.
+//
+// If the end marker of a paste is not read, for example because the paste
+// was truncated, the paste is considered over after 1 MiB of input, or, for
+// readers, once the proxy waited for input for half a second, so that escape
+// sequences are detected again. Time spent by the caller between reads does
+// not count.
+func WithBracketedPaste(enabled bool) EscapeOption {
+	return func(o *escapeOptions) {
+		o.noPaste = !enabled
+	}
+}
+
+// WithEscapeContext sets the context of the proxy. Once the context is done,
+// reads return the context's error, even if they are blocked waiting for
+// input. This is implemented in the same way as [WithEscapeTimeout], with the
+// same limitations.
+func WithEscapeContext(ctx context.Context) EscapeOption {
+	return func(o *escapeOptions) {
+		o.ctx = ctx
+	}
+}
+
+// EscapeHooks holds functions that a proxy calls as it detects escape
+// sequences, for example to show a hint after the first key of an escape
+// sequence is typed. Any of them may be nil. They are called synchronously
+// from the Read and Write methods of the proxy, and must not retain the byte
+// slices passed to them.
+type EscapeHooks struct {
+	// PartialMatch is called when the input may be the start of an escape
+	// sequence, with the bytes that are held back until enough input
+	// arrives to tell whether they are.
+	PartialMatch func(held []byte)
+	// Reset is called when bytes that were held back turn out not to be an
+	// escape sequence, or are released because of a timeout or the end of
+	// the input, with the bytes that are released to the caller.
+	Reset func(released []byte)
+	// Match is called when an escape sequence is read, with the error that
+	// the proxy returns.
+	Match func(err EscapeError)
+}
+
+// WithEscapeHooks sets the hooks that the proxy calls as it detects escape
+// sequences.
+func WithEscapeHooks(hooks EscapeHooks) EscapeOption {
+	return func(o *escapeOptions) {
+		o.hooks = &hooks
+	}
+}
+
+// EscapeStats counts the bytes processed by a proxy. Its methods may be called
+// concurrently with the proxy reading input.
+type EscapeStats struct {
+	read      uint64
+	forwarded uint64
+}
+
+// BytesRead returns the number of bytes the proxy read from the wrapped
+// reader, or that were written to the proxy for writers.
+func (s *EscapeStats) BytesRead() uint64 {
+	return atomic.LoadUint64(&s.read)
+}
+
+// BytesForwarded returns the number of bytes the proxy returned to the
+// caller, or wrote to the wrapped writer for writers. Bytes that are held
+// back, bytes of escape sequences, and bytes read after an escape sequence
+// are not forwarded.
+func (s *EscapeStats) BytesForwarded() uint64 {
+	return atomic.LoadUint64(&s.forwarded)
+}
+
+func (s *EscapeStats) add(read, forwarded int) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.read, uint64(read))
+	atomic.AddUint64(&s.forwarded, uint64(forwarded))
+}
+
+// WithEscapeStats sets the stats in which the proxy counts the bytes it
+// processes.
+func WithEscapeStats(stats *EscapeStats) EscapeOption {
+	return func(o *escapeOptions) {
+		o.stats = stats
+	}
 }
 
 // escapeProxy is used only for attaches with a TTY. It is used to proxy
 // stdin keypresses from the underlying reader and look for the passed in
 // escape key sequence to signal a detach.
 type escapeProxy struct {
-	escapeKeys   []byte
-	escapeKeyPos int
-	r            io.Reader
-	buf          []byte
+	matcher escapeMatcher
+	src     escapeSource
+	stats   *EscapeStats
+
+	// timeout is the time after which held bytes are returned to the
+	// caller, or zero to hold them indefinitely.
+	timeout time.Duration
+	// heldSince is the time at which the matcher started holding bytes.
+	heldSince time.Time
+	// waited is the time spent blocked reading from the source since input
+	// was last read. Time spent by the caller between reads is not counted.
+	waited time.Duration
+
+	// buf holds bytes to return to the caller that did not fit in the buffer
+	// passed to Read.
+	buf []byte
+	// in and out are scratch buffers for the bytes read from r, and the bytes
+	// to return to the caller.
+	in, out []byte
+	// err is the EscapeError returned once buf is drained.
+	err error
 }
 
 // NewEscapeProxy returns a new TTY proxy reader which wraps the given reader
@@ -27,62 +236,523 @@ type escapeProxy struct {
 // method will return an error of type EscapeError.
 func NewEscapeProxy(r io.Reader, escapeKeys []byte) io.Reader {
 	return &escapeProxy{
-		escapeKeys: escapeKeys,
-		r:          r,
+		matcher: escapeMatcher{
+			sequences: []escapeSequence{{keys: escapeKeys}},
+		},
+		src: readerSource{r: r},
 	}
 }
 
-func (r *escapeProxy) Read(buf []byte) (n int, err error) {
-	if len(r.escapeKeys) > 0 && r.escapeKeyPos == len(r.escapeKeys) {
-		return 0, EscapeError{}
+// NewEscapeProxyContext is like [NewEscapeProxy], but reads return the error of
+// the given context once it is done, even if they are blocked waiting for
+// input. This is implemented as described for [WithEscapeTimeout].
+func NewEscapeProxyContext(ctx context.Context, r io.Reader, escapeKeys []byte) io.Reader {
+	return &escapeProxy{
+		matcher: escapeMatcher{
+			sequences: []escapeSequence{{keys: escapeKeys}},
+		},
+		src: newEscapeSource(ctx, r, false),
 	}
+}
+
+// NewEscapeProxyWithOptions returns a new TTY proxy reader which wraps the
+// given reader, and detects the escape sequences configured by the given
+// options. When one of them is read, the Read method returns an
+// [EscapeError] that identifies it.
+func NewEscapeProxyWithOptions(r io.Reader, opts ...EscapeOption) io.Reader {
+	o := newEscapeOptions(opts)
+	return &escapeProxy{
+		matcher: newEscapeMatcher(o),
+		src:     newEscapeSource(o.ctx, r, o.timeout > 0),
+		stats:   o.stats,
+		timeout: o.timeout,
+	}
+}
+
+func newEscapeOptions(opts []EscapeOption) escapeOptions {
+	o := escapeOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
 
+func (r *escapeProxy) Read(buf []byte) (n int, err error) {
 	if len(r.buf) > 0 {
 		n = copy(buf, r.buf)
 		r.buf = r.buf[n:]
 	}
+	if r.err != nil {
+		if len(r.buf) > 0 {
+			return n, nil
+		}
+		return n, r.err
+	}
+	if n > 0 && n == len(buf) {
+		return n, nil
+	}
+
+	nr, err := r.readSource(buf[n:])
+	r.in = append(r.in[:0], buf[n:n+nr]...)
+	out, err := r.process(r.in, err)
+
+	nc := copy(buf[n:], out)
+	n += nc
+	r.buf = append(r.buf, out[nc:]...)
+	if r.err != nil && len(r.buf) > 0 {
+		// Return the EscapeError once the caller read everything that
+		// preceded the escape sequence.
+		return n, nil
+	}
+	return n, err
+}
+
+// WriteTo implements [io.WriterTo]. It writes the input to w until the end of
+// the input, an error, or an escape sequence is read, in which case it returns
+// an [EscapeError].
+func (r *escapeProxy) WriteTo(w io.Writer) (written int64, err error) {
+	if len(r.buf) > 0 {
+		nw, err := w.Write(r.buf)
+		written += int64(nw)
+		r.buf = r.buf[nw:]
+		if err != nil {
+			return written, err
+		}
+	}
+	if r.err != nil {
+		return written, r.err
+	}
+
+	if cap(r.in) < copyBufferSize {
+		r.in = make([]byte, copyBufferSize)
+	}
+	r.in = r.in[:cap(r.in)]
+	for {
+		nr, err := r.readSource(r.in)
+		out, err := r.process(r.in[:nr], err)
+		if len(out) > 0 {
+			nw, werr := w.Write(out)
+			written += int64(nw)
+			if werr == nil && nw != len(out) {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// copyBufferSize is the size of the buffer used by WriteTo, which is the same
+// as the buffer used by io.Copy.
+const copyBufferSize = 32 * 1024
+
+// readTimeout returns the timeout for the next read from the source.
+func (r *escapeProxy) readTimeout() time.Duration {
+	if r.timeout <= 0 || !r.matcher.holding() {
+		return -1
+	}
+	timeout := r.timeout - time.Since(r.heldSince)
+	if timeout < 0 {
+		timeout = 0
+	}
+	return timeout
+}
+
+// readSource reads from the source. Once input arrives after the proxy was
+// blocked waiting for it for longer than paste.IdleTimeout, a paste whose end
+// marker was not read is over.
+func (r *escapeProxy) readSource(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.src.read(p, r.readTimeout())
+	r.waited += time.Since(start)
+	if n > 0 {
+		if r.waited > paste.IdleTimeout {
+			r.matcher.paste.reset()
+		}
+		r.waited = 0
+	}
+	return n, err
+}
+
+// process feeds the bytes read from the source, and the error returned by the
+// source, to the matcher, and returns the bytes and the error to return to
+// the caller. The returned slice is only valid until the next call.
+func (r *escapeProxy) process(in []byte, err error) ([]byte, error) {
+	var escapeErr error
+	r.out, _, escapeErr = r.matcher.feed(r.out[:0], in)
+	if errors.Is(err, errReadTimeout) {
+		// The user stopped typing in the middle of what may be an escape
+		// sequence, so let the caller read it.
+		r.out = r.matcher.flush(r.out)
+		err = nil
+	}
+	defer func() {
+		r.stats.add(len(in), len(r.out))
+	}()
+	if !r.matcher.holding() {
+		r.heldSince = time.Time{}
+	} else if r.heldSince.IsZero() {
+		r.heldSince = time.Now()
+	}
+
+	if escapeErr != nil {
+		// Anything read after the escape sequence is discarded.
+		r.err = escapeErr
+		return r.out, escapeErr
+	}
+	if err != nil {
+		// No more input will arrive to complete a partial escape sequence,
+		// so let the caller read it.
+		r.out = r.matcher.flush(r.out)
+	}
+	return r.out, err
+}
+
+// escapeWriter is the writer-side equivalent of escapeProxy.
+type escapeWriter struct {
+	matcher escapeMatcher
+	w       io.Writer
+	stats   *EscapeStats
+	out     []byte
+	err     error
+}
+
+// NewEscapeWriter returns a new writer which writes to the given writer, and
+// detects when the specified escape keys are written, in which case the Write
+// method returns an error of type EscapeError. The escape keys are not
+// written to the underlying writer, and neither is anything written after
+// them.
+//
+// Bytes that may be the start of the escape keys are held back until enough
+// bytes are written to tell whether they are. Closing the writer writes any
+// bytes that are held back, but does not close the underlying writer.
+func NewEscapeWriter(w io.Writer, escapeKeys []byte) io.WriteCloser {
+	return &escapeWriter{
+		matcher: escapeMatcher{
+			sequences: []escapeSequence{{keys: escapeKeys}},
+		},
+		w: w,
+	}
+}
+
+// NewEscapeWriterWithOptions is like [NewEscapeWriter], but detects the
+// escape sequences configured by the given options, like
+// [NewEscapeProxyWithOptions]. [WithEscapeTimeout] has no effect on writers.
+func NewEscapeWriterWithOptions(w io.Writer, opts ...EscapeOption) io.WriteCloser {
+	o := newEscapeOptions(opts)
+	return &escapeWriter{
+		matcher: newEscapeMatcher(o),
+		w:       w,
+		stats:   o.stats,
+	}
+}
 
-	nr, err := r.r.Read(buf[n:])
-	n += nr
-	if len(r.escapeKeys) == 0 {
+// Write writes p to the underlying writer, up to the first escape sequence. If
+// an escape sequence is found, it returns the number of bytes of p up to and
+// including the escape sequence, and an [EscapeError]. Once an escape
+// sequence was found, all writes return an [EscapeError].
+func (ew *escapeWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	var (
+		n         int
+		escapeErr error
+	)
+	ew.out, n, escapeErr = ew.matcher.feed(ew.out[:0], p)
+	ew.stats.add(n, 0)
+	if err := ew.writeOut(); err != nil {
 		return n, err
 	}
+	if escapeErr != nil {
+		ew.err = escapeErr
+		return n, escapeErr
+	}
+	return n, nil
+}
+
+// Close writes any bytes held back because they may be the start of an escape
+// sequence to the underlying writer. It does not close the underlying writer.
+func (ew *escapeWriter) Close() error {
+	if ew.err != nil {
+		return nil
+	}
+	ew.out = ew.matcher.flush(ew.out[:0])
+	return ew.writeOut()
+}
+
+func (ew *escapeWriter) writeOut() error {
+	if len(ew.out) == 0 {
+		return nil
+	}
+	nw, err := ew.w.Write(ew.out)
+	ew.stats.add(0, nw)
+	if err == nil && nw != len(ew.out) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
 
-	for i := 0; i < n; i++ {
-		if buf[i] == r.escapeKeys[r.escapeKeyPos] {
-			r.escapeKeyPos++
+// escapeSequence is an escape sequence detected by an escapeMatcher.
+type escapeSequence struct {
+	name string
+	keys []byte
+	// literal is set for quoted escape sequences, and holds the bytes to
+	// return to the caller instead of detecting the escape sequence.
+	literal []byte
+}
 
-			// Check if the full escape sequence is matched.
-			if r.escapeKeyPos == len(r.escapeKeys) {
-				n = i + 1 - r.escapeKeyPos
-				if n < 0 {
-					n = 0
-				}
-				return n, EscapeError{}
+func newEscapeMatcher(o escapeOptions) escapeMatcher {
+	sequences := o.sequences
+	if len(o.quote) > 0 {
+		for _, seq := range o.sequences {
+			if len(seq.keys) == 0 {
+				continue
 			}
-			continue
+			sequences = append(sequences, escapeSequence{
+				name:    seq.name,
+				keys:    append(append([]byte(nil), o.quote...), seq.keys...),
+				literal: seq.keys,
+			})
 		}
+	}
+	return escapeMatcher{
+		sequences:   sequences,
+		named:       true,
+		hooks:       o.hooks,
+		noPaste:     o.noPaste,
+		lineEscape:  o.lineEscape,
+		atLineStart: true,
+	}
+}
+
+// escapeMatcher finds escape sequences in a stream of bytes. Bytes that may be
+// the start of an escape sequence are held back until enough bytes were read
+// to tell whether they are.
+type escapeMatcher struct {
+	sequences []escapeSequence
+	// named is set if matches are reported with the name and the keys of
+	// the matched sequence. Proxies created with NewEscapeProxy report an
+	// empty EscapeError, which callers may compare against.
+	named bool
+	// held holds the bytes that are a prefix of an escape sequence.
+	held []byte
+	// hooks are the hooks configured with WithEscapeHooks, if any.
+	hooks *EscapeHooks
+
+	// lineEscape is the line-start escape configured with
+	// WithLineStartEscape, if any.
+	lineEscape *lineEscape
+	// atLineStart is set if the next byte is at the start of a line.
+	atLineStart bool
+	// prefixHeld is set if the line-start escape prefix was read, and is
+	// held until the next byte is read.
+	prefixHeld bool
+
+	// noPaste is set if bracketed pastes are not recognized.
+	noPaste bool
+	// paste tracks the markers of bracketed pastes.
+	paste pasteTracker
+}
+
+// pasteTracker finds the start and end markers of bracketed pastes in a
+// stream of bytes, without holding them back.
+type pasteTracker struct {
+	// inPaste is set between the start and the end marker of a paste.
+	inPaste bool
+	// matched is the number of bytes of the next marker that were read.
+	matched int
+	// length is the number of bytes read since the start of the paste.
+	length int
+}
+
+// reset ends the current paste, if any.
+func (t *pasteTracker) reset() {
+	*t = pasteTracker{}
+}
+
+// observe processes c, and reports whether it completes the start marker of a
+// paste.
+func (t *pasteTracker) observe(c byte) bool {
+	marker := paste.Start
+	if t.inPaste {
+		marker = paste.End
+		t.length++
+	}
+	switch {
+	case c == marker[t.matched]:
+		t.matched++
+	case c == marker[0]:
+		t.matched = 1
+	default:
+		t.matched = 0
+	}
+	if t.matched < len(marker) {
+		return false
+	}
+	t.matched, t.length = 0, 0
+	t.inPaste = !t.inPaste
+	return t.inPaste
+}
 
-		// If we need to prepend a partial escape sequence from the previous
-		// read, make sure the new buffer size doesn't exceed len(buf).
-		// Otherwise, preserve any extra data in a buffer for the next read.
-		if i < r.escapeKeyPos {
-			preserve := make([]byte, 0, r.escapeKeyPos+n)
-			preserve = append(preserve, r.escapeKeys[:r.escapeKeyPos]...)
-			preserve = append(preserve, buf[:n]...)
-			n = copy(buf, preserve)
-			i += r.escapeKeyPos
-			r.buf = append(r.buf, preserve[n:]...)
+// lineEscape is a line-start escape, as configured by WithLineStartEscape.
+type lineEscape struct {
+	prefix   byte
+	commands []byte
+}
+
+// feed processes the bytes in p, appending the bytes that are not part of an
+// escape sequence to out. It stops at the end of the first escape sequence,
+// and returns the extended out, the number of bytes of p it processed, and an
+// EscapeError if an escape sequence was found.
+func (m *escapeMatcher) feed(out, p []byte) ([]byte, int, error) {
+	var err error
+	for i, c := range p {
+		if out, err = m.feedByte(out, c); err != nil {
+			return out, i + 1, err
 		}
-		r.escapeKeyPos = 0
 	}
+	return out, len(p), nil
+}
 
-	// If we're in the middle of reading an escape sequence, make sure we don't
-	// let the caller read it. If later on we find that this is not the escape
-	// sequence, we'll prepend it back to buf.
-	n -= r.escapeKeyPos
-	if n < 0 {
-		n = 0
+func (m *escapeMatcher) feedByte(out []byte, c byte) ([]byte, error) {
+	if m.noPaste {
+		return m.notifyByte(out, c)
 	}
-	return n, err
+	if m.paste.inPaste {
+		if m.paste.length < paste.MaxLen {
+			m.paste.observe(c)
+			return append(out, c), nil
+		}
+		// The end marker was not read, so the paste is considered over.
+		m.paste.reset()
+	}
+	out, err := m.notifyByte(out, c)
+	if err == nil && m.paste.observe(c) {
+		// The start marker of a paste may have been held back as the start
+		// of an escape sequence.
+		out = m.flush(out)
+	}
+	return out, err
+}
+
+// notifyByte processes c, and calls the hooks of the matcher, if any.
+func (m *escapeMatcher) notifyByte(out []byte, c byte) ([]byte, error) {
+	if m.hooks == nil {
+		return m.matchByte(out, c)
+	}
+	start, wasHolding := len(out), m.holding()
+	out, err := m.matchByte(out, c)
+	var escapeErr EscapeError
+	if errors.As(err, &escapeErr) {
+		if m.hooks.Match != nil {
+			m.hooks.Match(escapeErr)
+		}
+		return out, err
+	}
+	if wasHolding && len(out) > start && m.hooks.Reset != nil {
+		m.hooks.Reset(out[start:])
+	}
+	if m.holding() && m.hooks.PartialMatch != nil {
+		if m.prefixHeld {
+			m.hooks.PartialMatch([]byte{m.lineEscape.prefix})
+		} else {
+			m.hooks.PartialMatch(m.held)
+		}
+	}
+	return out, nil
+}
+
+func (m *escapeMatcher) matchByte(out []byte, c byte) ([]byte, error) {
+	atLineStart := m.atLineStart
+	m.atLineStart = c == '\r' || c == '\n'
+
+	if e := m.lineEscape; e != nil {
+		if m.prefixHeld {
+			m.prefixHeld = false
+			if c == e.prefix {
+				return append(out, c), nil
+			}
+			if bytes.IndexByte(e.commands, c) >= 0 {
+				return out, EscapeError{Name: keyName(c), Keys: string([]byte{e.prefix, c})}
+			}
+			out = append(out, e.prefix)
+		} else if atLineStart && c == e.prefix && len(m.held) == 0 {
+			m.prefixHeld = true
+			return out, nil
+		}
+	}
+
+	m.held = append(m.held, c)
+	for len(m.held) > 0 {
+		seq, partial := m.match()
+		if seq != nil {
+			m.held = m.held[:0]
+			if seq.literal != nil {
+				return append(out, seq.literal...), nil
+			}
+			return out, m.escapeError(seq)
+		}
+		if partial {
+			break
+		}
+		// The held bytes are not an escape sequence, so release the first
+		// one, and check whether the remaining ones are.
+		out = append(out, m.held[0])
+		m.held = m.held[:copy(m.held, m.held[1:])]
+	}
+	return out, nil
+}
+
+// match reports which escape sequence the held bytes match, or whether they
+// are a prefix of an escape sequence.
+func (m *escapeMatcher) match() (seq *escapeSequence, partial bool) {
+	for i := range m.sequences {
+		keys := m.sequences[i].keys
+		if len(keys) == 0 {
+			continue
+		}
+		if bytes.Equal(keys, m.held) {
+			return &m.sequences[i], false
+		}
+		if bytes.HasPrefix(keys, m.held) {
+			partial = true
+		}
+	}
+	return nil, partial
+}
+
+// holding reports whether the matcher holds bytes that may be part of an
+// escape sequence.
+func (m *escapeMatcher) holding() bool {
+	return len(m.held) > 0 || m.prefixHeld
+}
+
+// flush appends the held bytes to out, and returns the extended out.
+func (m *escapeMatcher) flush(out []byte) []byte {
+	start := len(out)
+	if m.prefixHeld {
+		out = append(out, m.lineEscape.prefix)
+		m.prefixHeld = false
+	}
+	out = append(out, m.held...)
+	m.held = m.held[:0]
+	if len(out) > start && m.hooks != nil && m.hooks.Reset != nil {
+		m.hooks.Reset(out[start:])
+	}
+	return out
+}
+
+func (m *escapeMatcher) escapeError(seq *escapeSequence) error {
+	if !m.named {
+		return EscapeError{}
+	}
+	return EscapeError{Name: seq.name, Keys: string(seq.keys)}
 }
@@ -0,0 +1,217 @@
+package term
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/moby/term/internal/async"
+)
+
+// errReadTimeout is returned by an escapeSource when no input arrived within
+// the timeout.
+var errReadTimeout = errors.New("read timeout")
+
+// pollInterval is the maximum time a cancellable escapeSource waits for input
+// before checking whether its context is done.
+const pollInterval = 100 * time.Millisecond
+
+// escapeSource reads the input of an escapeProxy.
+type escapeSource interface {
+	// read reads up to len(p) bytes into p. If timeout is not negative and
+	// no input arrives within timeout, it returns errReadTimeout. If the
+	// context of the source is done, it returns the context's error.
+	read(p []byte, timeout time.Duration) (int, error)
+}
+
+// newEscapeSource returns an escapeSource for r. Reading with a timeout, or
+// until ctx is done, requires to either poll r, if it is a terminal, to use
+// read deadlines if r is an *os.File that supports them, or to read from r in
+// a separate goroutine.
+// If none of that is needed, r is read from directly.
+func newEscapeSource(ctx context.Context, r io.Reader, needTimeout bool) escapeSource {
+	if !needTimeout && ctx.Done() == nil {
+		return readerSource{r: r}
+	}
+	if fd, ok := sourceFd(r); ok && IsTerminal(fd) {
+		return &pollSource{ctx: ctx, r: r, fd: fd}
+	}
+	if f, ok := r.(*os.File); ok && f.SetReadDeadline(time.Time{}) == nil {
+		return &deadlineSource{ctx: ctx, f: f}
+	}
+	return &asyncSource{ctx: ctx, r: r}
+}
+
+// sourceFd returns the file descriptor of r, if it has one. The file
+// descriptor of an *os.File is obtained without calling its Fd method, which
+// would put it in blocking mode, and so prevent read deadlines from
+// interrupting reads.
+func sourceFd(r io.Reader) (uintptr, bool) {
+	if f, ok := r.(*os.File); ok {
+		conn, err := f.SyscallConn()
+		if err != nil {
+			return 0, false
+		}
+		var fd uintptr
+		if err := conn.Control(func(sysfd uintptr) { fd = sysfd }); err != nil {
+			return 0, false
+		}
+		return fd, true
+	}
+	if f, ok := r.(interface{ Fd() uintptr }); ok {
+		return f.Fd(), true
+	}
+	return 0, false
+}
+
+// waitSlice returns how long a cancellable source waits for input before it
+// checks whether its context is done, given the remaining timeout, if not
+// negative.
+func waitSlice(remaining time.Duration) time.Duration {
+	if remaining >= 0 && remaining < pollInterval {
+		return remaining
+	}
+	return pollInterval
+}
+
+// deadline returns the time at which a read with the given timeout times out,
+// or the zero time if timeout is negative.
+func deadline(timeout time.Duration) time.Time {
+	if timeout < 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// remaining returns the time left until the given deadline, or -1 if the
+// deadline is the zero time.
+func remaining(deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return -1
+	}
+	if d := time.Until(deadline); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// readerSource reads from an io.Reader, and does not support timeouts.
+type readerSource struct {
+	r io.Reader
+}
+
+func (s readerSource) read(p []byte, _ time.Duration) (int, error) {
+	return s.r.Read(p)
+}
+
+// pollSource reads from a terminal, which it polls for input to implement
+// timeouts and cancellation.
+type pollSource struct {
+	ctx context.Context
+	r   io.Reader
+	fd  uintptr
+}
+
+func (s *pollSource) read(p []byte, timeout time.Duration) (int, error) {
+	d := deadline(timeout)
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return 0, err
+		}
+		wait := remaining(d)
+		if s.ctx.Done() != nil {
+			wait = waitSlice(wait)
+		}
+		ready, err := waitInput(s.fd, wait)
+		if err != nil {
+			return 0, err
+		}
+		if ready {
+			return s.r.Read(p)
+		}
+		if !d.IsZero() && !time.Now().Before(d) {
+			return 0, errReadTimeout
+		}
+	}
+}
+
+// deadlineSource reads from an *os.File that supports read deadlines, which
+// it uses to implement timeouts and cancellation.
+type deadlineSource struct {
+	ctx context.Context
+	f   *os.File
+}
+
+func (s *deadlineSource) read(p []byte, timeout time.Duration) (int, error) {
+	d := deadline(timeout)
+	defer func() {
+		_ = s.f.SetReadDeadline(time.Time{})
+	}()
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return 0, err
+		}
+		wait := remaining(d)
+		if s.ctx.Done() != nil {
+			wait = waitSlice(wait)
+		}
+		if wait >= 0 {
+			if err := s.f.SetReadDeadline(time.Now().Add(wait)); err != nil {
+				return 0, err
+			}
+		}
+		n, err := s.f.Read(p)
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return n, err
+		}
+		if !d.IsZero() && !time.Now().Before(d) {
+			return 0, errReadTimeout
+		}
+	}
+}
+
+// asyncSource reads from an io.Reader in a separate goroutine, which runs
+// async.ReadLoop, to implement timeouts and cancellation for readers that
+// cannot be polled.
+type asyncSource struct {
+	ctx     context.Context
+	r       io.Reader
+	results chan async.Result
+	// data holds the bytes read by the goroutine that were not returned yet.
+	data []byte
+	// err holds the error that ended the goroutine.
+	err error
+}
+
+func (s *asyncSource) read(p []byte, timeout time.Duration) (int, error) {
+	if len(s.data) == 0 && s.err == nil {
+		if s.results == nil {
+			s.results = make(chan async.Result)
+			go async.ReadLoop(s.r, 32*1024, s.results, s.ctx.Done())
+		}
+
+		var timer <-chan time.Time
+		if timeout >= 0 {
+			t := time.NewTimer(timeout)
+			defer t.Stop()
+			timer = t.C
+		}
+		select {
+		case res := <-s.results:
+			s.data, s.err = res.Data, res.Err
+		case <-timer:
+			return 0, errReadTimeout
+		case <-s.ctx.Done():
+			return 0, s.ctx.Err()
+		}
+	}
+
+	n := copy(p, s.data)
+	s.data = s.data[n:]
+	if len(s.data) > 0 {
+		return n, nil
+	}
+	return n, s.err
+}
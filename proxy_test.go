@@ -2,7 +2,17 @@ package term
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/moby/term/internal/paste"
 )
 
 func TestEscapeProxyRead(t *testing.T) {
@@ -323,3 +333,560 @@ func TestEscapeProxyRead(t *testing.T) {
 		}
 	})
 }
+
+func TestEscapeProxyWithOptions(t *testing.T) {
+	detachKeys, _ := ToBytes("ctrl-p,ctrl-q")
+	breakKeys, _ := ToBytes("ctrl-p,ctrl-b")
+	logKeys, _ := ToBytes("ctrl-l,ctrl-l")
+	newReader := func(keys []byte) io.Reader {
+		return NewEscapeProxyWithOptions(bytes.NewReader(keys),
+			WithEscapeSequence("detach", detachKeys),
+			WithEscapeSequence("send-break", breakKeys),
+			WithEscapeSequence("toggle-logging", logKeys),
+		)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		keys     string
+		expected string
+		err      error
+	}{
+		{
+			name:     "detach",
+			keys:     "a,ctrl-p,ctrl-q,b",
+			expected: "a",
+			err:      EscapeError{Name: "detach", Keys: "\x10\x11"},
+		},
+		{
+			name:     "send-break",
+			keys:     "a,ctrl-p,ctrl-b",
+			expected: "a",
+			err:      EscapeError{Name: "send-break", Keys: "\x10\x02"},
+		},
+		{
+			name:     "overlapping prefix",
+			keys:     "ctrl-l,ctrl-p,ctrl-l,ctrl-l",
+			expected: "\x0c\x10",
+			err:      EscapeError{Name: "toggle-logging", Keys: "\x0c\x0c"},
+		},
+		{
+			name:     "no match",
+			keys:     "ctrl-p,a,ctrl-l,b",
+			expected: "\x10a\x0cb",
+			err:      io.EOF,
+		},
+		{
+			name:     "partial match at end of input",
+			keys:     "a,ctrl-p",
+			expected: "a\x10",
+			err:      io.EOF,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			keys, _ := ToBytes(tc.keys)
+			reader := newReader(keys)
+
+			got, err := readAllByByte(reader)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected: %v, got: %v", tc.err, err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestEscapeProxyLineStartEscape(t *testing.T) {
+	detachKeys, _ := ToBytes("ctrl-p,ctrl-q")
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected string
+		err      error
+	}{
+		{name: "start of input", input: "~.", err: EscapeError{Name: ".", Keys: "~."}},
+		{name: "after CR", input: "ls\r~?", expected: "ls\r", err: EscapeError{Name: "?", Keys: "~?"}},
+		{name: "after LF", input: "ls\n~\x1a", expected: "ls\n", err: EscapeError{Name: "ctrl-z", Keys: "~\x1a"}},
+		{name: "middle of line", input: "a~.", expected: "a~.", err: io.EOF},
+		{name: "doubled prefix", input: "~~.", expected: "~.", err: io.EOF},
+		{name: "other key", input: "~a\r~#", expected: "~a\r", err: EscapeError{Name: "#", Keys: "~#"}},
+		{name: "prefix then newline", input: "~\r~.", expected: "~\r", err: EscapeError{Name: ".", Keys: "~."}},
+		{name: "prefix at end of input", input: "a\r~", expected: "a\r~", err: io.EOF},
+		{name: "escape sequence", input: "\x10\x11", err: EscapeError{Name: "detach", Keys: "\x10\x11"}},
+		{name: "escape sequence after prefix", input: "~\x10\x11", expected: "~", err: EscapeError{Name: "detach", Keys: "\x10\x11"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			reader := NewEscapeProxyWithOptions(bytes.NewReader([]byte(tc.input)),
+				WithEscapeSequence("detach", detachKeys),
+				WithLineStartEscape('~'),
+			)
+			got, err := readAllByByte(reader)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected: %v, got: %v", tc.err, err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// readAllByByte reads from r one byte at a time until an error occurs, and
+// returns the bytes read and the error.
+func readAllByByte(r io.Reader) ([]byte, error) {
+	var got []byte
+	buf := make([]byte, 1)
+	for {
+		nr, err := r.Read(buf)
+		got = append(got, buf[:nr]...)
+		if err != nil {
+			return got, err
+		}
+	}
+}
+
+func TestEscapeProxyTimeout(t *testing.T) {
+	escapeKeys, _ := ToBytes("ctrl-p,ctrl-q")
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	reader := NewEscapeProxyWithOptions(pr,
+		WithEscapeSequence("detach", escapeKeys),
+		WithEscapeTimeout(50*time.Millisecond),
+	)
+
+	go func() {
+		_, _ = pw.Write([]byte{escapeKeys[0]})
+	}()
+	buf := make([]byte, 8)
+	nr, err := reader.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 0; nr != expected {
+		t.Errorf("expected: %d, got: %d", expected, nr)
+	}
+
+	// No further input arrives, so the partial escape sequence is flushed.
+	start := time.Now()
+	nr, err = reader.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:nr], escapeKeys[:1]) {
+		t.Errorf("expected: %+v, got: %+v", escapeKeys[:1], buf[:nr])
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected partial escape sequence to be flushed after the timeout, took %v", elapsed)
+	}
+
+	// A complete escape sequence is still detected.
+	go func() {
+		_, _ = pw.Write(escapeKeys)
+	}()
+	for err == nil {
+		_, err = reader.Read(buf)
+	}
+	if expected := (EscapeError{Name: "detach", Keys: "\x10\x11"}); !errors.Is(err, expected) {
+		t.Errorf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestEscapeProxyContext(t *testing.T) {
+	escapeKeys, _ := ToBytes("ctrl-p,ctrl-q")
+	for _, tc := range []struct {
+		name string
+		pipe func(t *testing.T) (io.Reader, io.Writer)
+	}{
+		{
+			name: "io.Pipe",
+			pipe: func(t *testing.T) (io.Reader, io.Writer) {
+				pr, pw := io.Pipe()
+				t.Cleanup(func() { _ = pr.Close() })
+				return pr, pw
+			},
+		},
+		{
+			name: "os.Pipe",
+			pipe: func(t *testing.T) (io.Reader, io.Writer) {
+				pr, pw, err := os.Pipe()
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() {
+					_ = pr.Close()
+					_ = pw.Close()
+				})
+				return pr, pw
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pr, pw := tc.pipe(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			reader := NewEscapeProxyContext(ctx, pr, escapeKeys)
+
+			go func() {
+				_, _ = pw.Write([]byte("a"))
+			}()
+			buf := make([]byte, 8)
+			nr, err := reader.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := "a"; string(buf[:nr]) != expected {
+				t.Errorf("expected: %q, got: %q", expected, buf[:nr])
+			}
+
+			time.AfterFunc(50*time.Millisecond, cancel)
+			start := time.Now()
+			_, err = reader.Read(buf)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected: %v, got: %v", context.Canceled, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected read to return after cancellation, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestEscapeProxyQuote(t *testing.T) {
+	detachKeys, _ := ToBytes("ctrl-p,ctrl-q")
+	for _, tc := range []struct {
+		name     string
+		quote    string
+		input    string
+		expected string
+		err      error
+	}{
+		{name: "quoted", quote: "ctrl-v", input: "a,ctrl-v,ctrl-p,ctrl-q,b", expected: "a\x10\x11b", err: io.EOF},
+		{name: "quote alone", quote: "ctrl-v", input: "ctrl-v,a", expected: "\x16a", err: io.EOF},
+		{name: "quote then partial", quote: "ctrl-v", input: "ctrl-v,ctrl-p,a", expected: "\x16\x10a", err: io.EOF},
+		{name: "unquoted", quote: "ctrl-v", input: "a,ctrl-p,ctrl-q", expected: "a", err: EscapeError{Name: "detach", Keys: "\x10\x11"}},
+		{name: "doubled first key", quote: "ctrl-p", input: "ctrl-p,ctrl-p,ctrl-q,b", expected: "\x10\x11b", err: io.EOF},
+		{name: "doubled first key then other", quote: "ctrl-p", input: "ctrl-p,ctrl-p,a", expected: "\x10\x10a", err: io.EOF},
+		{name: "doubled first key then escape", quote: "ctrl-p", input: "ctrl-p,ctrl-p,ctrl-q,ctrl-p,ctrl-q", expected: "\x10\x11", err: EscapeError{Name: "detach", Keys: "\x10\x11"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			quote, _ := ToBytes(tc.quote)
+			input, _ := ToBytes(tc.input)
+			reader := NewEscapeProxyWithOptions(bytes.NewReader(input),
+				WithEscapeSequence("detach", detachKeys),
+				WithEscapeQuote(quote),
+			)
+			got, err := readAllByByte(reader)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected: %v, got: %v", tc.err, err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestEscapeProxyWriteTo(t *testing.T) {
+	escapeKeys, _ := ToBytes("ctrl-p,ctrl-q")
+
+	t.Run("escape sequence", func(t *testing.T) {
+		keys, _ := ToBytes("a,b,ctrl-p,c,ctrl-p,ctrl-q,d")
+		reader := NewEscapeProxy(bytes.NewReader(keys), escapeKeys)
+		if _, ok := reader.(io.WriterTo); !ok {
+			t.Fatal("expected proxy to implement io.WriterTo")
+		}
+
+		var out bytes.Buffer
+		nw, err := io.Copy(&out, reader)
+		if !errors.Is(err, EscapeError{}) {
+			t.Errorf("expected: %v, got: %v", EscapeError{}, err)
+		}
+		if expected := "ab\x10c"; out.String() != expected {
+			t.Errorf("expected: %q, got: %q", expected, out.String())
+		}
+		if nw != int64(out.Len()) {
+			t.Errorf("expected: %d, got: %d", out.Len(), nw)
+		}
+	})
+
+	t.Run("EOF", func(t *testing.T) {
+		keys, _ := ToBytes("a,b,ctrl-p")
+		reader := NewEscapeProxy(bytes.NewReader(keys), escapeKeys)
+
+		var out bytes.Buffer
+		if _, err := io.Copy(&out, reader); err != nil {
+			t.Error(err)
+		}
+		if expected := "ab\x10"; out.String() != expected {
+			t.Errorf("expected: %q, got: %q", expected, out.String())
+		}
+	})
+}
+
+func TestEscapeWriter(t *testing.T) {
+	escapeKeys, _ := ToBytes("ctrl-p,ctrl-q")
+
+	t.Run("escape sequence", func(t *testing.T) {
+		var out bytes.Buffer
+		writer := NewEscapeWriter(&out, escapeKeys)
+
+		nw, err := writer.Write([]byte("ab\x10"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := 3; nw != expected {
+			t.Errorf("expected: %d, got: %d", expected, nw)
+		}
+		if expected := "ab"; out.String() != expected {
+			t.Errorf("expected: %q, got: %q", expected, out.String())
+		}
+
+		nw, err = writer.Write([]byte("c\x10\x11d"))
+		if !errors.Is(err, EscapeError{}) {
+			t.Errorf("expected: %v, got: %v", EscapeError{}, err)
+		}
+		if expected := 3; nw != expected {
+			t.Errorf("expected: %d, got: %d", expected, nw)
+		}
+		if expected := "ab\x10c"; out.String() != expected {
+			t.Errorf("expected: %q, got: %q", expected, out.String())
+		}
+
+		if _, err := writer.Write([]byte("e")); !errors.Is(err, EscapeError{}) {
+			t.Errorf("expected: %v, got: %v", EscapeError{}, err)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		var out bytes.Buffer
+		writer := NewEscapeWriterWithOptions(&out, WithEscapeSequence("detach", escapeKeys))
+		if _, err := writer.Write([]byte("ab\x10")); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if expected := "ab\x10"; out.String() != expected {
+			t.Errorf("expected: %q, got: %q", expected, out.String())
+		}
+	})
+}
+
+func TestEscapeProxyHooks(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		input     string
+		events    []string
+		forwarded uint64
+	}{
+		{
+			name:      "no escape",
+			input:     "a,b",
+			forwarded: 2,
+		},
+		{
+			name:      "partial match reset",
+			input:     "a,ctrl-p,b",
+			events:    []string{`partial "\x10"`, `reset "\x10b"`},
+			forwarded: 3,
+		},
+		{
+			name:      "partial match at end of input",
+			input:     "a,ctrl-p",
+			events:    []string{`partial "\x10"`, `reset "\x10"`},
+			forwarded: 2,
+		},
+		{
+			name:      "match",
+			input:     "a,ctrl-p,ctrl-q,b",
+			events:    []string{`partial "\x10"`, `match "detach"`},
+			forwarded: 1,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			escapeKeys, _ := ToBytes("ctrl-p,ctrl-q")
+			input, _ := ToBytes(tc.input)
+			var events []string
+			var stats EscapeStats
+			reader := NewEscapeProxyWithOptions(bytes.NewReader(input),
+				WithEscapeSequence("detach", escapeKeys),
+				WithEscapeHooks(EscapeHooks{
+					PartialMatch: func(held []byte) {
+						events = append(events, fmt.Sprintf("partial %q", held))
+					},
+					Reset: func(released []byte) {
+						events = append(events, fmt.Sprintf("reset %q", released))
+					},
+					Match: func(err EscapeError) {
+						events = append(events, fmt.Sprintf("match %q", err.Name))
+					},
+				}),
+				WithEscapeStats(&stats),
+			)
+
+			_, _ = io.ReadAll(reader)
+			if !reflect.DeepEqual(events, tc.events) {
+				t.Errorf("expected: %q, got: %q", tc.events, events)
+			}
+			if expected := uint64(len(input)); stats.BytesRead() != expected {
+				t.Errorf("expected: %d, got: %d", expected, stats.BytesRead())
+			}
+			if stats.BytesForwarded() != tc.forwarded {
+				t.Errorf("expected: %d, got: %d", tc.forwarded, stats.BytesForwarded())
+			}
+		})
+	}
+}
+
+func TestEscapeProxyBracketedPaste(t *testing.T) {
+	escapeKeys, _ := ToBytes("ctrl-p,ctrl-q")
+	paste := "\x1b[200~a\x10\x11b\x1b[201~"
+	for _, tc := range []struct {
+		name     string
+		opts     []EscapeOption
+		input    string
+		expected string
+		err      error
+	}{
+		{
+			name:     "escape sequence in paste",
+			input:    paste + "c",
+			expected: paste + "c",
+			err:      io.EOF,
+		},
+		{
+			name:     "escape sequence after paste",
+			input:    paste + "\x10\x11c",
+			expected: paste,
+			err:      EscapeError{Name: "detach", Keys: "\x10\x11"},
+		},
+		{
+			name:     "partial escape sequence before paste",
+			input:    "\x10" + paste,
+			expected: "\x10" + paste,
+			err:      io.EOF,
+		},
+		{
+			name:     "paste disabled",
+			opts:     []EscapeOption{WithBracketedPaste(false)},
+			input:    paste,
+			expected: "\x1b[200~a",
+			err:      EscapeError{Name: "detach", Keys: "\x10\x11"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]EscapeOption{WithEscapeSequence("detach", escapeKeys)}, tc.opts...)
+			reader := NewEscapeProxyWithOptions(bytes.NewReader([]byte(tc.input)), opts...)
+			out, err := readAllByByte(reader)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected: %v, got: %v", tc.err, err)
+			}
+			if string(out) != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, out)
+			}
+		})
+	}
+
+	t.Run("legacy proxy", func(t *testing.T) {
+		reader := NewEscapeProxy(bytes.NewReader([]byte(paste)), escapeKeys)
+		out, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != paste {
+			t.Errorf("expected: %q, got: %q", paste, out)
+		}
+	})
+}
+
+func TestEscapeProxyUnterminatedPaste(t *testing.T) {
+	escapeKeys, _ := ToBytes("ctrl-p,ctrl-q")
+
+	t.Run("idle", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		reader := NewEscapeProxy(pr, escapeKeys)
+		go func() {
+			_, _ = pw.Write([]byte("\x1b[200~abc"))
+			time.Sleep(paste.IdleTimeout + 100*time.Millisecond)
+			_, _ = pw.Write(escapeKeys)
+		}()
+
+		buf := make([]byte, 32)
+		var err error
+		for err == nil {
+			_, err = reader.Read(buf)
+		}
+		if !errors.Is(err, EscapeError{}) {
+			t.Errorf("expected: %v, got: %v", EscapeError{}, err)
+		}
+	})
+
+	t.Run("slow consumer", func(t *testing.T) {
+		input := "\x1b[200~hello world\x10\x11 more text\x1b[201~"
+		reader := NewEscapeProxy(strings.NewReader(input), escapeKeys)
+		buf := make([]byte, 8)
+		var out []byte
+		for {
+			n, err := reader.Read(buf)
+			out = append(out, buf[:n]...)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out) == n {
+				time.Sleep(paste.IdleTimeout + 100*time.Millisecond)
+			}
+		}
+		if string(out) != input {
+			t.Errorf("expected: %q, got: %q", input, out)
+		}
+	})
+
+	t.Run("slow writer", func(t *testing.T) {
+		input := paste.Start + strings.Repeat("a", copyBufferSize) + "\x10\x11" + paste.End
+		reader := NewEscapeProxy(strings.NewReader(input), escapeKeys)
+		var out bytes.Buffer
+		w := writerFunc(func(p []byte) (int, error) {
+			if out.Len() == 0 {
+				time.Sleep(paste.IdleTimeout + 100*time.Millisecond)
+			}
+			return out.Write(p)
+		})
+		if _, err := io.Copy(w, reader); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != input {
+			t.Errorf("expected %d bytes, got: %d", len(input), out.Len())
+		}
+	})
+
+	t.Run("length", func(t *testing.T) {
+		input := append([]byte(paste.Start), bytes.Repeat([]byte("a"), paste.MaxLen)...)
+		input = append(input, escapeKeys...)
+		reader := NewEscapeProxy(bytes.NewReader(input), escapeKeys)
+		out, err := io.ReadAll(reader)
+		if !errors.Is(err, EscapeError{}) {
+			t.Errorf("expected: %v, got: %v", EscapeError{}, err)
+		}
+		if expected := len(input) - len(escapeKeys); len(out) != expected {
+			t.Errorf("expected: %d, got: %d", expected, len(out))
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,130 @@
+package term
+
+import "sync"
+
+// modified holds the original state of the terminals whose state was changed
+// by this package, so that they can be restored by [RestoreAll]. Terminals are
+// identified by their file descriptor, so entries must be removed with
+// [Forget] before the file descriptor is closed.
+var modified = &registry{
+	states: map[uintptr]*State{},
+	pastes: map[uintptr]struct{}{},
+}
+
+type registry struct {
+	mu     sync.Mutex
+	states map[uintptr]*State
+	// pastes holds the terminals on which bracketed paste mode was enabled.
+	pastes map[uintptr]struct{}
+}
+
+// track records the state to restore the terminal connected to fd to. If the
+// terminal is already tracked, the state that was recorded first is kept.
+func (r *registry) track(fd uintptr, state *State) {
+	if state == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.states[fd]; !ok {
+		r.states[fd] = state
+	}
+}
+
+// untrack stops tracking the terminal connected to fd if the given state, to
+// which the terminal was restored, is the state that was recorded for it.
+// Restoring the terminal to an intermediate state, such as the state returned
+// by MakeCbreak after calling MakeRaw, keeps the original state recorded.
+func (r *registry) untrack(fd uintptr, state *State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if recorded, ok := r.states[fd]; ok && sameMode(recorded, state) {
+		delete(r.states, fd)
+	}
+}
+
+// forget stops tracking the terminal connected to fd.
+func (r *registry) forget(fd uintptr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.states, fd)
+	delete(r.pastes, fd)
+}
+
+// sameMode reports whether a and b describe the same terminal mode. Whether
+// restoring them disables bracketed paste mode is not compared.
+func sameMode(a, b *State) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	x, y := *a, *b
+	x.bracketedPaste, y.bracketedPaste = false, false
+	return x == y
+}
+
+func (r *registry) trackPaste(fd uintptr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pastes[fd] = struct{}{}
+}
+
+func (r *registry) untrackPaste(fd uintptr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pastes, fd)
+}
+
+func (r *registry) restoreAll() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for fd, state := range r.states {
+		if err := restoreTerminal(fd, state); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.states, fd)
+	}
+	for fd := range r.pastes {
+		if err := disableBracketedPaste(fd); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.pastes, fd)
+	}
+	return firstErr
+}
+
+// RestoreAll restores every terminal whose state was changed by this package
+// (through [SetRawTerminal], [SetRawTerminalOutput], [DisableEcho], [MakeRaw],
+// [MakeRawWithOptions] or [MakeCbreak]) to the state it was in before it was
+// first changed, and disables bracketed paste mode on every terminal it was
+// enabled on with [EnableBracketedPaste]. Terminals that were restored to that
+// state with [RestoreTerminal] are not restored again.
+//
+// Terminals are identified by their file descriptor. If a file descriptor is
+// closed without restoring its terminal, and its number is reused for another
+// terminal, RestoreAll applies the recorded state to that other terminal; call
+// [Forget] before closing a file descriptor to prevent this.
+//
+// All terminals are restored even if restoring one of them fails, in which
+// case the first error is returned. RestoreAll is safe for concurrent use.
+func RestoreAll() error {
+	return modified.restoreAll()
+}
+
+// Forget stops tracking the terminal connected to the given file descriptor, so
+// that [RestoreAll] no longer restores it. It should be called before closing a
+// file descriptor whose terminal state was changed by this package, unless the
+// terminal was restored.
+func Forget(fd uintptr) {
+	modified.forget(fd)
+}
+
+// RestoreAllOnTerminate arranges for [RestoreAll] to be called when the
+// process receives a signal that terminates it, with the same semantics as
+// [Guard]. The returned function stops handling signals.
+func RestoreAllOnTerminate() (stop func()) {
+	return onTerminate(func() {
+		_ = RestoreAll()
+	})
+}
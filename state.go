@@ -0,0 +1,182 @@
+package term
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// stateVersion is the version of the serialized form of a [State]. It must be
+// incremented when the encoding changes incompatibly.
+const stateVersion = 1
+
+// stateFlagBracketedPaste is set in the flags of a serialized [State] if
+// restoring the state disables bracketed paste mode.
+const stateFlagBracketedPaste = 1
+
+// statePlatform identifies the platform a serialized [State] was created on.
+// The layout of the terminal state differs between operating systems and
+// architectures, so a state can only be restored on the same platform.
+const statePlatform = runtime.GOOS + "/" + runtime.GOARCH
+
+// Echo reports whether input characters are echoed back to the terminal.
+//
+// Like the other accessors, it may be called on a nil *State, for which it
+// reports false.
+func (s *State) Echo() bool {
+	return s != nil && s.echo()
+}
+
+// Canonical reports whether canonical (line-buffered) input is enabled, in
+// which case input is made available line by line, with line editing.
+func (s *State) Canonical() bool {
+	return s != nil && s.canonical()
+}
+
+// Signals reports whether interrupt keys, such as Ctrl-C, generate signals.
+func (s *State) Signals() bool {
+	return s != nil && s.signals()
+}
+
+// OutputProcessing reports whether output post-processing, such as LF -> CRLF
+// translation, is enabled.
+func (s *State) OutputProcessing() bool {
+	return s != nil && s.outputProcessing()
+}
+
+// Raw reports whether the state describes a terminal in raw mode, with echo,
+// canonical input, signal generation and output processing all disabled. It
+// reports false for a nil *State.
+func (s *State) Raw() bool {
+	return s != nil && !s.Echo() && !s.Canonical() && !s.Signals() && !s.OutputProcessing()
+}
+
+// String returns a human-readable description of the terminal mode, for
+// example "cooked (echo: on, canonical: on, signals: on, output processing: on)".
+func (s *State) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+	var mode string
+	switch {
+	case s.Raw():
+		mode = "raw"
+	case s.Canonical():
+		mode = "cooked"
+	default:
+		mode = "cbreak"
+	}
+	return fmt.Sprintf("%s (echo: %s, canonical: %s, signals: %s, output processing: %s)",
+		mode, onOff(s.Echo()), onOff(s.Canonical()), onOff(s.Signals()), onOff(s.OutputProcessing()))
+}
+
+func onOff(v bool) string {
+	if v {
+		return "on"
+	}
+	return "off"
+}
+
+// MarshalBinary implements [encoding.BinaryMarshaler]. The encoded state is
+// tagged with a version and the platform it was created on, and can only be
+// decoded on the same platform. It records whether restoring the state
+// disables bracketed paste mode, as for states returned by
+// [EnableBracketedPaste].
+func (s *State) MarshalBinary() ([]byte, error) {
+	payload, err := s.marshal()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, 3+len(statePlatform)+len(payload))
+	data = append(data, stateVersion, byte(len(statePlatform)))
+	data = append(data, statePlatform...)
+	data = append(data, s.flags())
+	data = append(data, payload...)
+	return data, nil
+}
+
+// UnmarshalBinary implements [encoding.BinaryUnmarshaler]. It returns an error
+// if the data was encoded by a different version of this package, or on a
+// different platform.
+func (s *State) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return errors.New("invalid terminal state: data too short")
+	}
+	platform := string(data[2 : 2+int(data[1])])
+	if err := checkStateHeader(int(data[0]), platform); err != nil {
+		return err
+	}
+	payload := data[2+len(platform):]
+	if len(payload) == 0 {
+		return errors.New("invalid terminal state: data too short")
+	}
+	flags, payload := payload[0], payload[1:]
+	if err := s.unmarshal(payload); err != nil {
+		return err
+	}
+	s.setFlags(flags)
+	return nil
+}
+
+type stateJSON struct {
+	Version        int    `json:"version"`
+	Platform       string `json:"platform"`
+	BracketedPaste bool   `json:"bracketedPaste,omitempty"`
+	Data           []byte `json:"data"`
+}
+
+// MarshalJSON implements [json.Marshaler]. Like [State.MarshalBinary], the
+// encoded state is tagged with a version and the platform it was created on.
+func (s *State) MarshalJSON() ([]byte, error) {
+	payload, err := s.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stateJSON{
+		Version:        stateVersion,
+		Platform:       statePlatform,
+		BracketedPaste: s.bracketedPaste,
+		Data:           payload,
+	})
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]. It returns an error if the
+// data was encoded by a different version of this package, or on a different
+// platform.
+func (s *State) UnmarshalJSON(data []byte) error {
+	var v stateJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkStateHeader(v.Version, v.Platform); err != nil {
+		return err
+	}
+	if err := s.unmarshal(v.Data); err != nil {
+		return err
+	}
+	s.bracketedPaste = v.BracketedPaste
+	return nil
+}
+
+func (s *State) flags() byte {
+	var flags byte
+	if s.bracketedPaste {
+		flags |= stateFlagBracketedPaste
+	}
+	return flags
+}
+
+func (s *State) setFlags(flags byte) {
+	s.bracketedPaste = flags&stateFlagBracketedPaste != 0
+}
+
+func checkStateHeader(version int, platform string) error {
+	if version != stateVersion {
+		return fmt.Errorf("unsupported terminal state version: %d", version)
+	}
+	if platform != statePlatform {
+		return fmt.Errorf("terminal state was saved on %s and cannot be restored on %s", platform, statePlatform)
+	}
+	return nil
+}
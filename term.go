@@ -10,8 +10,32 @@ type Winsize struct {
 	Height uint16
 	Width  uint16
 
-	x uint16 //nolint:unused // only used on Unix
-	y uint16 //nolint:unused // only used on Unix
+	x uint16
+	y uint16
+}
+
+// PixelSize returns the width and height of the terminal window in pixels.
+// Both are zero if the size in pixels is unknown, which is always the case on
+// Windows. Use [GetWinsizeWithPixels] to query the terminal itself when the
+// system does not report its size in pixels.
+func (ws *Winsize) PixelSize() (width, height uint16) {
+	return ws.x, ws.y
+}
+
+// SetPixelSize sets the width and height of the terminal window in pixels, as
+// applied by [SetWinsize].
+func (ws *Winsize) SetPixelSize(width, height uint16) {
+	ws.x, ws.y = width, height
+}
+
+// CellSize returns the width and height of a character cell in pixels, as
+// derived from the size of the window in pixels and in cells. Both are zero if
+// the size in pixels is unknown.
+func (ws *Winsize) CellSize() (width, height uint16) {
+	if ws.Width == 0 || ws.Height == 0 {
+		return 0, 0
+	}
+	return ws.x / ws.Width, ws.y / ws.Height
 }
 
 // StdStreams returns the standard streams (stdin, stdout, stderr).
@@ -45,9 +69,21 @@ func IsTerminal(fd uintptr) bool {
 }
 
 // RestoreTerminal restores the terminal connected to the given file descriptor
-// to a previous state.
+// to a previous state. Once restored to the state it was in before this
+// package first changed it, the terminal is no longer restored by
+// [RestoreAll].
+//
+// If the state was returned by [EnableBracketedPaste], bracketed paste mode is
+// disabled as well.
 func RestoreTerminal(fd uintptr, state *State) error {
-	return restoreTerminal(fd, state)
+	if err := restoreTerminal(fd, state); err != nil {
+		return err
+	}
+	modified.untrack(fd, state)
+	if state.bracketedPaste {
+		return DisableBracketedPaste(fd)
+	}
+	return nil
 }
 
 // SaveState saves the state of the terminal connected to the given file descriptor.
@@ -57,28 +93,129 @@ func SaveState(fd uintptr) (*State, error) {
 
 // DisableEcho applies the specified state to the terminal connected to the file
 // descriptor, with echo disabled.
+//
+// On Windows, it also arranges for the terminal to be restored when the
+// process receives Ctrl-C, with the same semantics as [Guard].
 func DisableEcho(fd uintptr, state *State) error {
-	return disableEcho(fd, state)
+	if err := disableEcho(fd, state); err != nil {
+		return err
+	}
+	modified.track(fd, state)
+	return nil
 }
 
 // SetRawTerminal puts the terminal connected to the given file descriptor into
 // raw mode and returns the previous state. On UNIX, this is the equivalent of
 // [MakeRaw], and puts both the input and output into raw mode. On Windows, it
 // only puts the input into raw mode.
+//
+// On Windows, it also arranges for the terminal to be restored when the
+// process receives Ctrl-C, with the same semantics as [Guard].
 func SetRawTerminal(fd uintptr) (previousState *State, err error) {
-	return setRawTerminal(fd)
+	previousState, err = setRawTerminal(fd)
+	if err != nil {
+		return nil, err
+	}
+	modified.track(fd, previousState)
+	return previousState, nil
 }
 
 // SetRawTerminalOutput puts the output of terminal connected to the given file
 // descriptor into raw mode. On UNIX, this does nothing and returns nil for the
 // state. On Windows, it disables LF -> CRLF translation.
 func SetRawTerminalOutput(fd uintptr) (previousState *State, err error) {
-	return setRawTerminalOutput(fd)
+	previousState, err = setRawTerminalOutput(fd)
+	if err != nil {
+		return nil, err
+	}
+	modified.track(fd, previousState)
+	return previousState, nil
 }
 
 // MakeRaw puts the terminal (Windows Console) connected to the
 // given file descriptor into raw mode and returns the previous state of
 // the terminal so that it can be restored.
 func MakeRaw(fd uintptr) (previousState *State, err error) {
-	return makeRaw(fd)
+	return MakeRawWithOptions(fd)
+}
+
+// MakeRawWithOptions is like [MakeRaw], but allows the caller to keep some
+// of the terminal features that raw mode disables by default. Without any
+// options, it is the equivalent of [MakeRaw].
+func MakeRawWithOptions(fd uintptr, opts ...RawOption) (previousState *State, err error) {
+	o := newRawOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	previousState, err = makeRaw(fd, o)
+	if err != nil {
+		return nil, err
+	}
+	modified.track(fd, previousState)
+	return previousState, nil
+}
+
+// MakeCbreak puts the terminal (Windows Console) connected to the given file
+// descriptor into cbreak mode and returns the previous state of the terminal
+// so that it can be restored. In cbreak mode, input is available one key at a
+// time and is not echoed, but unlike raw mode, interrupt keys (such as Ctrl-C)
+// still generate signals and output post-processing (such as LF -> CRLF
+// translation) is left enabled.
+func MakeCbreak(fd uintptr) (previousState *State, err error) {
+	previousState, err = makeCbreak(fd)
+	if err != nil {
+		return nil, err
+	}
+	modified.track(fd, previousState)
+	return previousState, nil
+}
+
+// RawOption configures how [MakeRawWithOptions] puts a terminal into raw mode.
+type RawOption func(*rawOptions)
+
+type rawOptions struct {
+	signals          bool
+	outputProcessing bool
+	flowControl      bool
+	vmin, vtime      uint8
+}
+
+func newRawOptions() rawOptions {
+	return rawOptions{vmin: 1, vtime: 0}
+}
+
+// WithSignals keeps signal generation enabled, so that interrupt keys such as
+// Ctrl-C still deliver a signal (ISIG). On Windows, it keeps
+// ENABLE_PROCESSED_INPUT enabled.
+func WithSignals() RawOption {
+	return func(o *rawOptions) {
+		o.signals = true
+	}
+}
+
+// WithOutputProcessing keeps output post-processing, such as LF -> CRLF
+// translation, enabled (OPOST). It has no effect on Windows, where output
+// processing is a property of the output handle.
+func WithOutputProcessing() RawOption {
+	return func(o *rawOptions) {
+		o.outputProcessing = true
+	}
+}
+
+// WithFlowControl keeps XON/XOFF output flow control (IXON) enabled. It has
+// no effect on Windows.
+func WithFlowControl() RawOption {
+	return func(o *rawOptions) {
+		o.flowControl = true
+	}
+}
+
+// WithVMinVTime sets the minimum number of bytes (VMIN) and the timeout in
+// tenths of a second (VTIME) for non-canonical reads. By default, raw mode
+// uses VMIN=1 and VTIME=0. It has no effect on Windows.
+func WithVMinVTime(vmin, vtime uint8) RawOption {
+	return func(o *rawOptions) {
+		o.vmin = vmin
+		o.vtime = vtime
+	}
 }
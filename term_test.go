@@ -4,11 +4,19 @@
 package term
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
+	"os/signal"
 	"reflect"
 	"testing"
+	"time"
 
 	cpty "github.com/creack/pty"
+	"golang.org/x/sys/unix"
 )
 
 func newTTYForTest(t *testing.T) *os.File {
@@ -26,6 +34,21 @@ func newTTYForTest(t *testing.T) *os.File {
 	return pty
 }
 
+// newPTYPairForTest returns both ends of a new pty: the controlling side,
+// which acts as the terminal emulator, and the terminal device.
+func newPTYPairForTest(t *testing.T) (pty, tty *os.File) {
+	t.Helper()
+	pty, tty, err := cpty.Open()
+	if err != nil {
+		t.Fatalf("error creating pty: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = pty.Close()
+		_ = tty.Close()
+	})
+	return pty, tty
+}
+
 func newTempFile(t *testing.T) *os.File {
 	t.Helper()
 	tmpFile, err := os.CreateTemp(t.TempDir(), "temp")
@@ -151,3 +174,668 @@ func TestDisableEcho(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestMakeCbreak(t *testing.T) {
+	tty := newTTYForTest(t)
+	state, err := MakeCbreak(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := RestoreTerminal(tty.Fd(), state); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	termios, err := tcget(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if termios.Lflag&(unix.ECHO|unix.ICANON) != 0 {
+		t.Error("expected echo and canonical mode to be disabled")
+	}
+	if termios.Lflag&unix.ISIG == 0 {
+		t.Error("expected signals to be enabled")
+	}
+	if termios.Oflag&unix.OPOST == 0 {
+		t.Error("expected output processing to be enabled")
+	}
+}
+
+func TestMakeRawWithOptions(t *testing.T) {
+	tty := newTTYForTest(t)
+	state, err := MakeRawWithOptions(tty.Fd(), WithSignals(), WithOutputProcessing(), WithVMinVTime(0, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := RestoreTerminal(tty.Fd(), state); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	termios, err := tcget(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if termios.Lflag&(unix.ECHO|unix.ICANON) != 0 {
+		t.Error("expected echo and canonical mode to be disabled")
+	}
+	if termios.Lflag&unix.ISIG == 0 {
+		t.Error("expected signals to be enabled")
+	}
+	if termios.Oflag&unix.OPOST == 0 {
+		t.Error("expected output processing to be enabled")
+	}
+	if termios.Iflag&unix.IXON != 0 {
+		t.Error("expected flow control to be disabled")
+	}
+	if vmin, vtime := termios.Cc[unix.VMIN], termios.Cc[unix.VTIME]; vmin != 0 || vtime != 5 {
+		t.Errorf("expected: VMIN=0 VTIME=5, got: VMIN=%d VTIME=%d", vmin, vtime)
+	}
+}
+
+func TestStateAccessors(t *testing.T) {
+	tty := newTTYForTest(t)
+	state, err := SaveState(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Raw() {
+		t.Errorf("expected initial state to not be raw, got: %s", state)
+	}
+
+	oldState, err := MakeRaw(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := RestoreTerminal(tty.Fd(), oldState); err != nil {
+			t.Error(err)
+		}
+	}()
+	state, err = SaveState(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Raw() {
+		t.Errorf("expected state to be raw, got: %s", state)
+	}
+	if state.Echo() || state.Canonical() || state.Signals() || state.OutputProcessing() {
+		t.Errorf("expected all features to be disabled, got: %s", state)
+	}
+	if expected := "raw (echo: off, canonical: off, signals: off, output processing: off)"; state.String() != expected {
+		t.Errorf("expected: %q, got: %q", expected, state.String())
+	}
+
+	if err := RestoreTerminal(tty.Fd(), oldState); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MakeCbreak(tty.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	state, err = SaveState(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "cbreak (echo: off, canonical: off, signals: on, output processing: on)"; state.String() != expected {
+		t.Errorf("expected: %q, got: %q", expected, state.String())
+	}
+
+	var nilState *State
+	if nilState.Echo() || nilState.Canonical() || nilState.Signals() || nilState.OutputProcessing() || nilState.Raw() {
+		t.Error("expected accessors of a nil state to report false")
+	}
+	if expected := "<nil>"; nilState.String() != expected {
+		t.Errorf("expected: %q, got: %q", expected, nilState.String())
+	}
+}
+
+func TestStateMarshal(t *testing.T) {
+	tty := newTTYForTest(t)
+	state, err := SaveState(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := state.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded State
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, *state) {
+		t.Errorf("expected: %+v, got: %+v", *state, decoded)
+	}
+	if err := RestoreTerminal(tty.Fd(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = State{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, *state) {
+		t.Errorf("expected: %+v, got: %+v", *state, decoded)
+	}
+
+	// Whether restoring the state disables bracketed paste mode is kept.
+	pasteState := *state
+	pasteState.bracketedPaste = true
+	for _, marshal := range []func() ([]byte, error){pasteState.MarshalBinary, pasteState.MarshalJSON} {
+		data, err = marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = State{}
+		if data[0] == '{' {
+			err = json.Unmarshal(data, &decoded)
+		} else {
+			err = decoded.UnmarshalBinary(data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, pasteState) {
+			t.Errorf("expected: %+v, got: %+v", pasteState, decoded)
+		}
+	}
+
+	data, err = state.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[2] = 'x' // corrupt the platform tag
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Error("expected an error for a state saved on a different platform")
+	}
+	if err := decoded.UnmarshalBinary(data[:1]); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
+
+func TestGuard(t *testing.T) {
+	tty := newTTYForTest(t)
+
+	t.Run("restore", func(t *testing.T) {
+		r, err := Guard(tty.Fd())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := MakeRaw(tty.Fd()); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Restore(); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Restore(); err != nil {
+			t.Fatal(err)
+		}
+		assertState(t, tty.Fd(), r.State())
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		r, err := Guard(tty.Fd())
+		if err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			defer func() {
+				if p := recover(); p == nil {
+					t.Error("expected panic to propagate")
+				}
+			}()
+			defer r.RestoreOnPanic()
+			if _, err := MakeRaw(tty.Fd()); err != nil {
+				t.Fatal(err)
+			}
+			panic("boom")
+		}()
+		assertState(t, tty.Fd(), r.State())
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		// Handle SIGHUP ourselves, so that the re-raised signal does not
+		// terminate the test.
+		sigCh := make(chan os.Signal, 2)
+		signal.Notify(sigCh, unix.SIGHUP)
+		defer signal.Stop(sigCh)
+
+		r, err := Guard(tty.Fd())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := MakeRaw(tty.Fd()); err != nil {
+			t.Fatal(err)
+		}
+		if err := unix.Kill(unix.Getpid(), unix.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case <-sigCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for signal")
+			}
+		}
+		assertState(t, tty.Fd(), r.State())
+	})
+}
+
+func assertState(t *testing.T, fd uintptr, expected *State) {
+	t.Helper()
+	state, err := SaveState(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("expected: %s, got: %s", expected, state)
+	}
+}
+
+func TestRestoreAll(t *testing.T) {
+	tty1 := newTTYForTest(t)
+	tty2 := newTTYForTest(t)
+	state1, err := SaveState(tty1.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state2, err := SaveState(tty2.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SetRawTerminal(tty1.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MakeCbreak(tty1.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	if err := DisableEcho(tty2.Fd(), state2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RestoreAll(); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, tty1.Fd(), state1)
+	assertState(t, tty2.Fd(), state2)
+
+	// Terminals restored through RestoreTerminal are not restored again.
+	oldState, err := MakeRaw(tty1.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreTerminal(tty1.Fd(), oldState); err != nil {
+		t.Fatal(err)
+	}
+	if err := tty1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreAll(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifyWinsize(t *testing.T) {
+	tty := newTTYForTest(t)
+	if err := SetWinsize(tty.Fd(), &Winsize{Width: 80, Height: 24}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := NotifyWinsize(ctx, tty.Fd())
+
+	recv := func() Winsize {
+		t.Helper()
+		select {
+		case ws := <-ch:
+			return ws
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for window size")
+		}
+		return Winsize{}
+	}
+
+	if ws := recv(); ws.Width != 80 || ws.Height != 24 {
+		t.Errorf("expected: 80x24, got: %dx%d", ws.Width, ws.Height)
+	}
+
+	if err := SetWinsize(tty.Fd(), &Winsize{Width: 120, Height: 40}); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Kill(unix.Getpid(), unix.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+	if ws := recv(); ws.Width != 120 || ws.Height != 40 {
+		t.Errorf("expected: 120x40, got: %dx%d", ws.Width, ws.Height)
+	}
+
+	cancel()
+	for range ch {
+		// Drain until the channel is closed.
+	}
+}
+
+func TestForwardWinsize(t *testing.T) {
+	src := newTTYForTest(t)
+	dst := newTTYForTest(t)
+	srcSize := Winsize{Width: 100, Height: 30, x: 800, y: 600}
+	if err := SetWinsize(src.Fd(), &srcSize); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ForwardWinsize(ctx, src.Fd(), dst.Fd())
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ws, err := GetWinsize(dst.Fd())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *ws == srcSize {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected: %+v, got: %+v", srcSize, *ws)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestGetWinsizeWithPixels(t *testing.T) {
+	t.Run("reported by ioctl", func(t *testing.T) {
+		tty := newTTYForTest(t)
+		expected := Winsize{Width: 80, Height: 24}
+		expected.SetPixelSize(800, 480)
+		if err := SetWinsize(tty.Fd(), &expected); err != nil {
+			t.Fatal(err)
+		}
+		ws, err := GetWinsizeWithPixels(tty.Fd(), tty.Fd(), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *ws != expected {
+			t.Errorf("expected: %+v, got: %+v", expected, *ws)
+		}
+		if w, h := ws.CellSize(); w != 10 || h != 20 {
+			t.Errorf("expected cell size: 10x20, got: %dx%d", w, h)
+		}
+	})
+
+	for _, tc := range []struct {
+		name    string
+		replies string
+		width   uint16
+		height  uint16
+	}{
+		{name: "text area", replies: "\x1b[4;480;800t\x1b[6;20;10t\x1b[?62;22c", width: 800, height: 480},
+		{name: "cell size", replies: "\x1b[6;20;10t\x1b[?62;22c", width: 800, height: 480},
+		{name: "unsupported", replies: "\x1b[?1;2c"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pty, tty := newPTYPairForTest(t)
+			if err := SetWinsize(pty.Fd(), &Winsize{Width: 80, Height: 24}); err != nil {
+				t.Fatal(err)
+			}
+
+			go func() {
+				buf := make([]byte, len(pixelSizeQuery))
+				if _, err := io.ReadFull(pty, buf); err != nil {
+					return
+				}
+				_, _ = pty.WriteString(tc.replies)
+			}()
+
+			ws, err := GetWinsizeWithPixels(tty.Fd(), tty.Fd(), 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := ws.PixelSize(); w != tc.width || h != tc.height {
+				t.Errorf("expected: %dx%d, got: %dx%d", tc.width, tc.height, w, h)
+			}
+		})
+	}
+}
+
+func TestGetWinsizeOrDefault(t *testing.T) {
+	def := Winsize{Width: 80, Height: 24}
+
+	tty := newTTYForTest(t)
+	if err := SetWinsize(tty.Fd(), &Winsize{Width: 100, Height: 50}); err != nil {
+		t.Fatal(err)
+	}
+	ws, source := GetWinsizeOrDefault(tty.Fd(), def)
+	if source != WinsizeFromFd || ws.Width != 100 || ws.Height != 50 {
+		t.Errorf("expected: 100x50 from fd, got: %dx%d from %s", ws.Width, ws.Height, source)
+	}
+
+	if _, err := controllingTerminalWinsize(); err == nil {
+		t.Skip("process has a controlling terminal")
+	}
+	tmpFile := newTempFile(t)
+
+	t.Setenv("COLUMNS", "132")
+	t.Setenv("LINES", "")
+	ws, source = GetWinsizeOrDefault(tmpFile.Fd(), def)
+	if source != WinsizeFromEnv || ws.Width != 132 || ws.Height != 24 {
+		t.Errorf("expected: 132x24 from environment, got: %dx%d from %s", ws.Width, ws.Height, source)
+	}
+
+	t.Setenv("COLUMNS", "invalid")
+	ws, source = GetWinsizeOrDefault(tmpFile.Fd(), def)
+	if source != WinsizeFromDefault || *ws != def {
+		t.Errorf("expected: 80x24 from default, got: %dx%d from %s", ws.Width, ws.Height, source)
+	}
+}
+
+func TestOpenControllingTerminal(t *testing.T) {
+	tty, err := OpenControllingTerminal()
+	if err != nil {
+		t.Skipf("process has no controlling terminal: %v", err)
+	}
+	defer tty.Close()
+
+	fd, isTerm := GetFdInfo(tty)
+	if fd != tty.Fd() {
+		t.Errorf("expected: %d, got: %d", tty.Fd(), fd)
+	}
+	if !isTerm {
+		t.Error("expected controlling terminal to be a terminal")
+	}
+	if _, err := GetWinsize(tty.OutFd()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	pty, tty := newPTYPairForTest(t)
+	state, err := SaveState(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// typeInput writes input to the terminal once ReadPassword changed its
+	// mode; in canonical mode, Ctrl-C would flush the input queue.
+	typeInput := func(input string) {
+		go func() {
+			for {
+				s, err := SaveState(tty.Fd())
+				if err != nil {
+					return
+				}
+				if !s.Canonical() {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			_, _ = pty.WriteString(input)
+		}()
+	}
+
+	typeInput("secret\r")
+	secret, err := ReadPassword(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "secret"; string(secret) != expected {
+		t.Errorf("expected: %q, got: %q", expected, secret)
+	}
+	assertState(t, tty.Fd(), state)
+
+	typeInput("sec\x03")
+	if _, err := ReadPassword(tty.Fd()); !errors.Is(err, InterruptError{}) {
+		t.Errorf("expected: %v, got: %v", InterruptError{}, err)
+	}
+	assertState(t, tty.Fd(), state)
+}
+
+func TestEscapeProxyTimeoutTerminal(t *testing.T) {
+	pty, tty := newPTYPairForTest(t)
+	state, err := MakeRaw(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := RestoreTerminal(tty.Fd(), state); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	reader := NewEscapeProxyWithOptions(tty,
+		WithEscapeSequence("detach", []byte{0x10, 0x11}),
+		WithEscapeTimeout(50*time.Millisecond),
+	)
+	if _, err := pty.Write([]byte{0x10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	buf := make([]byte, 8)
+	for len(got) == 0 {
+		nr, err := reader.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:nr]...)
+	}
+	if expected := []byte{0x10}; !bytes.Equal(got, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, got)
+	}
+}
+
+func TestEscapeProxyContextTerminal(t *testing.T) {
+	_, tty := newPTYPairForTest(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	reader := NewEscapeProxyWithOptions(tty,
+		WithEscapeSequence("detach", []byte{0x10, 0x11}),
+		WithEscapeContext(ctx),
+	)
+
+	start := time.Now()
+	_, err := reader.Read(make([]byte, 8))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected read to return after cancellation, took %v", elapsed)
+	}
+}
+
+func TestEnableBracketedPaste(t *testing.T) {
+	pty, tty := newPTYPairForTest(t)
+	state, err := EnableBracketedPaste(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(bracketedPasteOn))
+	if _, err := io.ReadFull(pty, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != bracketedPasteOn {
+		t.Errorf("expected: %q, got: %q", bracketedPasteOn, buf)
+	}
+
+	if err := RestoreTerminal(tty.Fd(), state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(pty, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != bracketedPasteOff {
+		t.Errorf("expected: %q, got: %q", bracketedPasteOff, buf)
+	}
+
+	if _, err := EnableBracketedPaste(tty.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreAll(); err != nil {
+		t.Fatal(err)
+	}
+	expected := bracketedPasteOn + bracketedPasteOff
+	buf = make([]byte, len(expected))
+	if _, err := io.ReadFull(pty, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != expected {
+		t.Errorf("expected: %q, got: %q", expected, buf)
+	}
+}
+
+func TestRestoreAllNested(t *testing.T) {
+	tty := newTTYForTest(t)
+	original, err := SaveState(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MakeRaw(tty.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	rawState, err := MakeCbreak(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Restoring an intermediate state keeps the original state recorded.
+	if err := RestoreTerminal(tty.Fd(), rawState); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreAll(); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, tty.Fd(), original)
+
+	// Forgotten terminals are not restored.
+	if _, err := MakeRaw(tty.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	Forget(tty.Fd())
+	if err := RestoreAll(); err != nil {
+		t.Fatal(err)
+	}
+	state, err := SaveState(tty.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Raw() {
+		t.Errorf("expected forgotten terminal to stay in raw mode, got: %v", state)
+	}
+}
@@ -4,10 +4,13 @@
 package term
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"io"
 	"math"
 	"os"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -15,6 +18,45 @@ import (
 // terminalState holds the platform-specific state / console mode for the terminal.
 type terminalState struct {
 	termios unix.Termios
+	// bracketedPaste is set if restoring the state disables bracketed
+	// paste mode, as for states returned by EnableBracketedPaste.
+	bracketedPaste bool
+}
+
+func (s *State) echo() bool {
+	return s.termios.Lflag&unix.ECHO != 0
+}
+
+func (s *State) canonical() bool {
+	return s.termios.Lflag&unix.ICANON != 0
+}
+
+func (s *State) signals() bool {
+	return s.termios.Lflag&unix.ISIG != 0
+}
+
+func (s *State) outputProcessing() bool {
+	return s.termios.Oflag&unix.OPOST != 0
+}
+
+func (s *State) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &s.termios); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *State) unmarshal(data []byte) error {
+	var termios unix.Termios
+	if len(data) != binary.Size(&termios) {
+		return errors.New("invalid terminal state: unexpected size")
+	}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &termios); err != nil {
+		return err
+	}
+	s.termios = termios
+	return nil
 }
 
 func stdStreams() (stdIn io.ReadCloser, stdOut, stdErr io.Writer) {
@@ -24,13 +66,25 @@ func stdStreams() (stdIn io.ReadCloser, stdOut, stdErr io.Writer) {
 func getFdInfo(in interface{}) (uintptr, bool) {
 	var inFd uintptr
 	var isTerminalIn bool
-	if file, ok := in.(*os.File); ok {
-		inFd = file.Fd()
+	switch t := in.(type) {
+	case *os.File:
+		inFd = t.Fd()
+		isTerminalIn = isTerminal(inFd)
+	case *ControllingTerminal:
+		inFd = t.Fd()
 		isTerminalIn = isTerminal(inFd)
 	}
 	return inFd, isTerminalIn
 }
 
+func openControllingTerminal() (*ControllingTerminal, error) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ControllingTerminal{in: f, out: f}, nil
+}
+
 func getWinsize(fd uintptr) (*Winsize, error) {
 	if fd > math.MaxInt {
 		return nil, errors.New("invalid file descriptor")
@@ -80,7 +134,7 @@ func disableEcho(fd uintptr, state *State) error {
 }
 
 func setRawTerminal(fd uintptr) (*State, error) {
-	return makeRaw(fd)
+	return makeRaw(fd, newRawOptions())
 }
 
 func setRawTerminalOutput(uintptr) (*State, error) {
@@ -104,3 +158,62 @@ func tcset(fd uintptr, p *unix.Termios) error {
 	}
 	return unix.IoctlSetTermios(int(fd), setTermios, p)
 }
+
+// waitInput waits until input is available to read from fd, or until the
+// timeout elapses, and reports whether input is available. A negative timeout
+// waits indefinitely.
+func waitInput(fd uintptr, timeout time.Duration) (bool, error) {
+	if fd > math.MaxInt32 {
+		return false, errors.New("invalid file descriptor")
+	}
+	ms := -1
+	if timeout >= 0 {
+		ms = math.MaxInt32
+		if d := (timeout + time.Millisecond - 1) / time.Millisecond; d < math.MaxInt32 {
+			ms = int(d)
+		}
+	}
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, ms)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+}
+
+func readFd(fd uintptr, p []byte) (int, error) {
+	if fd > math.MaxInt {
+		return 0, errors.New("invalid file descriptor")
+	}
+	for {
+		n, err := unix.Read(int(fd), p)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if n < 0 {
+			n = 0
+		}
+		return n, err
+	}
+}
+
+func writeFd(fd uintptr, p []byte) (int, error) {
+	if fd > math.MaxInt {
+		return 0, errors.New("invalid file descriptor")
+	}
+	for {
+		n, err := unix.Write(int(fd), p)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if n < 0 {
+			n = 0
+		}
+		return n, err
+	}
+}
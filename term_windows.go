@@ -1,12 +1,15 @@
 package term
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
 	"math"
 	"os"
-	"os/signal"
+	"time"
+	"unsafe"
 
+	"github.com/Azure/go-ansiterm/winterm"
 	windowsconsole "github.com/moby/term/windows"
 	"golang.org/x/sys/windows"
 )
@@ -14,6 +17,42 @@ import (
 // terminalState holds the platform-specific state / console mode for the terminal.
 type terminalState struct {
 	mode uint32
+	// bracketedPaste is set if restoring the state disables bracketed
+	// paste mode, as for states returned by EnableBracketedPaste.
+	bracketedPaste bool
+}
+
+func (s *State) echo() bool {
+	return s.mode&windows.ENABLE_ECHO_INPUT != 0
+}
+
+func (s *State) canonical() bool {
+	return s.mode&windows.ENABLE_LINE_INPUT != 0
+}
+
+func (s *State) signals() bool {
+	return s.mode&windows.ENABLE_PROCESSED_INPUT != 0
+}
+
+// outputProcessing reports whether ENABLE_PROCESSED_OUTPUT is set. A console
+// mode does not record whether it belongs to an input or an output handle,
+// and this bit is shared with ENABLE_PROCESSED_INPUT.
+func (s *State) outputProcessing() bool {
+	return s.mode&windows.ENABLE_PROCESSED_OUTPUT != 0
+}
+
+func (s *State) marshal() ([]byte, error) {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, s.mode)
+	return data, nil
+}
+
+func (s *State) unmarshal(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("invalid terminal state: unexpected size")
+	}
+	s.mode = binary.LittleEndian.Uint32(data)
+	return nil
 }
 
 // vtInputSupported is true if winterm.ENABLE_VIRTUAL_TERMINAL_INPUT is supported by the console
@@ -86,9 +125,25 @@ func stdStreams() (stdIn io.ReadCloser, stdOut, stdErr io.Writer) {
 }
 
 func getFdInfo(in interface{}) (uintptr, bool) {
+	if t, ok := in.(*ControllingTerminal); ok {
+		return t.Fd(), isTerminal(t.Fd())
+	}
 	return windowsconsole.GetHandleInfo(in)
 }
 
+func openControllingTerminal() (*ControllingTerminal, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile("CONOUT$", os.O_RDWR, 0)
+	if err != nil {
+		_ = in.Close()
+		return nil, err
+	}
+	return &ControllingTerminal{in: in, out: out}, nil
+}
+
 func getWinsize(fd uintptr) (*Winsize, error) {
 	var info windows.ConsoleScreenBufferInfo
 	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
@@ -169,13 +224,89 @@ func setRawTerminalOutput(fd uintptr) (*State, error) {
 	return oldState, err
 }
 
+// restoreAtInterrupt restores the terminal to the given state when the process
+// receives a console control event, such as Ctrl-C. Like [Guard], it does not
+// consume the event, which is then handled as if the handler was not
+// installed.
 func restoreAtInterrupt(fd uintptr, state *State) {
-	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, os.Interrupt)
-
-	go func() {
-		<-sigchan
+	onTerminate(func() {
 		_ = RestoreTerminal(fd, state)
-		os.Exit(0)
-	}()
+	})
+}
+
+var procPeekConsoleInput = windows.NewLazySystemDLL("kernel32.dll").NewProc("PeekConsoleInputW")
+
+// waitInput waits until input is available to read from fd, or until the
+// timeout elapses, and reports whether input is available. A negative timeout
+// waits indefinitely. Console input events that do not provide input, such as
+// window-resize, focus and mouse events, are discarded.
+func waitInput(fd uintptr, timeout time.Duration) (bool, error) {
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		ms := uint32(windows.INFINITE)
+		if timeout >= 0 {
+			remaining := time.Until(deadline)
+			if remaining < 0 {
+				remaining = 0
+			}
+			if d := (remaining + time.Millisecond - 1) / time.Millisecond; d < windows.INFINITE {
+				ms = uint32(d)
+			}
+		}
+		event, err := windows.WaitForSingleObject(windows.Handle(fd), ms)
+		if err != nil {
+			return false, err
+		}
+		if event != windows.WAIT_OBJECT_0 {
+			return false, nil
+		}
+		ready, err := hasKeyInput(fd)
+		if err != nil || ready {
+			return ready, err
+		}
+		if timeout >= 0 && !time.Now().Before(deadline) {
+			return false, nil
+		}
+	}
+}
+
+// hasKeyInput reports whether the next console input event of fd is a key
+// press. Events before it that are not, such as window-resize, focus and mouse
+// events, and key releases, are discarded: they signal the console handle, but
+// reading from it would block until a key is pressed.
+func hasKeyInput(fd uintptr) (bool, error) {
+	var (
+		records [1]winterm.INPUT_RECORD
+		n       uint32
+	)
+	for {
+		r1, _, err := procPeekConsoleInput.Call(fd, uintptr(unsafe.Pointer(&records[0])), 1, uintptr(unsafe.Pointer(&n)))
+		if r1 == 0 {
+			return false, err
+		}
+		if n == 0 {
+			return false, nil
+		}
+		if r := records[0]; r.EventType == winterm.KEY_EVENT && r.KeyEvent.KeyDown != 0 {
+			return true, nil
+		}
+		if err := winterm.ReadConsoleInput(fd, records[:], &n); err != nil {
+			return false, err
+		}
+	}
+}
+
+func readFd(fd uintptr, p []byte) (int, error) {
+	var n uint32
+	err := windows.ReadFile(windows.Handle(fd), p, &n, nil)
+	return int(n), err
+}
+
+func writeFd(fd uintptr, p []byte) (int, error) {
+	var n uint32
+	err := windows.WriteFile(windows.Handle(fd), p, &n, nil)
+	return int(n), err
 }
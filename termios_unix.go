@@ -7,7 +7,7 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func makeRaw(fd uintptr) (*State, error) {
+func makeRaw(fd uintptr, opts rawOptions) (*State, error) {
 	termios, err := tcget(fd)
 	if err != nil {
 		return nil, err
@@ -15,11 +15,37 @@ func makeRaw(fd uintptr) (*State, error) {
 
 	oldState := State{termios: *termios}
 
-	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
-	termios.Oflag &^= unix.OPOST
-	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL
+	if !opts.flowControl {
+		termios.Iflag &^= unix.IXON
+	}
+	if !opts.outputProcessing {
+		termios.Oflag &^= unix.OPOST
+	}
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.IEXTEN
+	if !opts.signals {
+		termios.Lflag &^= unix.ISIG
+	}
 	termios.Cflag &^= unix.CSIZE | unix.PARENB
 	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = opts.vmin
+	termios.Cc[unix.VTIME] = opts.vtime
+
+	if err := tcset(fd, termios); err != nil {
+		return nil, err
+	}
+	return &oldState, nil
+}
+
+func makeCbreak(fd uintptr) (*State, error) {
+	termios, err := tcget(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	oldState := State{termios: *termios}
+
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON
 	termios.Cc[unix.VMIN] = 1
 	termios.Cc[unix.VTIME] = 0
 
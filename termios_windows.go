@@ -2,7 +2,7 @@ package term
 
 import "golang.org/x/sys/windows"
 
-func makeRaw(fd uintptr) (*State, error) {
+func makeRaw(fd uintptr, opts rawOptions) (*State, error) {
 	state, err := SaveState(fd)
 	if err != nil {
 		return nil, err
@@ -19,7 +19,9 @@ func makeRaw(fd uintptr) (*State, error) {
 	mode &^= windows.ENABLE_LINE_INPUT
 	mode &^= windows.ENABLE_MOUSE_INPUT
 	mode &^= windows.ENABLE_WINDOW_INPUT
-	mode &^= windows.ENABLE_PROCESSED_INPUT
+	if !opts.signals {
+		mode &^= windows.ENABLE_PROCESSED_INPUT
+	}
 
 	// Enable these modes
 	mode |= windows.ENABLE_EXTENDED_FLAGS
@@ -35,3 +37,27 @@ func makeRaw(fd uintptr) (*State, error) {
 	}
 	return state, nil
 }
+
+func makeCbreak(fd uintptr) (*State, error) {
+	state, err := SaveState(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := state.mode
+
+	// Disable line editing and echo, but keep ENABLE_PROCESSED_INPUT so that
+	// Ctrl-C is still handled by the system.
+	mode &^= windows.ENABLE_ECHO_INPUT
+	mode &^= windows.ENABLE_LINE_INPUT
+	mode |= windows.ENABLE_PROCESSED_INPUT
+	if vtInputSupported {
+		mode |= windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	}
+
+	err = windows.SetConsoleMode(windows.Handle(fd), mode)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
@@ -0,0 +1,68 @@
+package term
+
+import "os"
+
+// ControllingTerminal is a read/write handle on the controlling terminal of
+// the process, as returned by [OpenControllingTerminal].
+type ControllingTerminal struct {
+	in  *os.File
+	out *os.File
+}
+
+// OpenControllingTerminal opens the controlling terminal of the process for
+// reading and writing, regardless of whether the standard streams are
+// redirected. This allows prompting the user, for example for a confirmation
+// or a password, while data is being piped into the process.
+//
+// On Unix, this opens "/dev/tty". On Windows, this opens the console input
+// ("CONIN$") and output ("CONOUT$") buffers.
+func OpenControllingTerminal() (*ControllingTerminal, error) {
+	return openControllingTerminal()
+}
+
+// Read reads input from the terminal.
+func (t *ControllingTerminal) Read(p []byte) (int, error) {
+	return t.in.Read(p)
+}
+
+// Write writes output to the terminal.
+func (t *ControllingTerminal) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+// Close closes the terminal, and stops tracking it for [RestoreAll], as
+// [Forget] does.
+func (t *ControllingTerminal) Close() error {
+	Forget(t.in.Fd())
+	Forget(t.out.Fd())
+	err := t.in.Close()
+	if t.out != t.in {
+		if outErr := t.out.Close(); err == nil {
+			err = outErr
+		}
+	}
+	return err
+}
+
+// Fd returns the file descriptor of the input side of the terminal, to be used
+// with functions that change the terminal mode, such as [SaveState],
+// [MakeRaw] and [DisableEcho].
+func (t *ControllingTerminal) Fd() uintptr {
+	return t.in.Fd()
+}
+
+// OutFd returns the file descriptor of the output side of the terminal, to be
+// used with [GetWinsize]. On Unix, this is the same file descriptor as
+// returned by [ControllingTerminal.Fd].
+func (t *ControllingTerminal) OutFd() uintptr {
+	return t.out.Fd()
+}
+
+func controllingTerminalWinsize() (*Winsize, error) {
+	t, err := openControllingTerminal()
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return getWinsize(t.OutFd())
+}
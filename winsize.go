@@ -0,0 +1,254 @@
+package term
+
+import (
+	"context"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// NotifyWinsize returns a channel that receives the size of the terminal
+// connected to the given file descriptor, first its current size and then
+// every time it changes, until ctx is done, after which the channel is closed.
+//
+// On Unix, changes are detected by listening for SIGWINCH. On Windows, the
+// console screen buffer is polled periodically.
+//
+// Changes are coalesced: a size is only sent if it differs from the previous
+// one, and if the receiver falls behind, only the most recent size is kept.
+func NotifyWinsize(ctx context.Context, fd uintptr) <-chan Winsize {
+	ch := make(chan Winsize, 1)
+	changed, stop := watchWinsize()
+
+	go func() {
+		defer close(ch)
+		defer stop()
+
+		var last *Winsize
+		update := func() {
+			ws, err := GetWinsize(fd)
+			if err != nil || (last != nil && *ws == *last) {
+				return
+			}
+			last = ws
+			select {
+			case ch <- *ws:
+			default:
+				// Replace the size the receiver did not pick up yet. This
+				// goroutine is the only sender, so the channel has room
+				// after draining it.
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- *ws
+			}
+		}
+
+		update()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				update()
+			}
+		}
+	}()
+	return ch
+}
+
+// ForwardWinsize copies the size of the terminal connected to src, including
+// its pixel dimensions, to the terminal connected to dst (typically a pty),
+// first immediately and then every time it changes, until ctx is done.
+//
+// It returns ctx.Err() once ctx is done, or the first error returned by
+// [SetWinsize]. Because [SetWinsize] is not implemented on Windows, dst must
+// be a Unix terminal.
+func ForwardWinsize(ctx context.Context, src, dst uintptr) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for ws := range NotifyWinsize(ctx, src) {
+		ws := ws
+		if err := SetWinsize(dst, &ws); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// pixelSizeQuery asks the terminal for the size of its text area in pixels
+// (XTWINOPS 14), for the size of a character cell in pixels (XTWINOPS 16),
+// and for its primary device attributes (DA1). Terminals that do not support
+// XTWINOPS ignore those queries, but all terminals reply to DA1, and they
+// reply in order, so the DA1 reply marks the end of the replies.
+const pixelSizeQuery = "\x1b[14t\x1b[16t\x1b[c"
+
+var (
+	pixelSizeReply = regexp.MustCompile(`\x1b\[([46]);(\d+);(\d+)t`)
+	deviceAttrs    = regexp.MustCompile(`\x1b\[\?[\d;]*c`)
+)
+
+// GetWinsizeWithPixels is like [GetWinsize], but if the system does not report
+// the size of the terminal in pixels, the terminal itself is queried for it,
+// using the XTWINOPS control sequences to report the text area size (CSI 14 t)
+// and the character cell size (CSI 16 t) in pixels.
+//
+// The size in cells is read from out, to which the queries are written. The
+// replies are read from in, which is put into raw mode while waiting for them
+// for at most the given timeout. Any other input that arrives in the meantime
+// is discarded. If the terminal does not report its size in pixels, the
+// returned size has no pixel dimensions.
+func GetWinsizeWithPixels(in, out uintptr, timeout time.Duration) (*Winsize, error) {
+	ws, err := GetWinsize(out)
+	if err != nil {
+		return nil, err
+	}
+	if ws.x != 0 && ws.y != 0 {
+		return ws, nil
+	}
+
+	state, err := MakeRaw(in)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = RestoreTerminal(in, state)
+	}()
+
+	if _, err := writeFd(out, []byte(pixelSizeQuery)); err != nil {
+		return nil, err
+	}
+
+	var (
+		replies  []byte
+		buf      = make([]byte, 256)
+		deadline = time.Now().Add(timeout)
+	)
+	for !deviceAttrs.Match(replies) {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		ready, err := waitInput(in, remaining)
+		if err != nil {
+			return nil, err
+		}
+		if !ready {
+			break
+		}
+		n, err := readFd(in, buf)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, buf[:n]...)
+	}
+
+	var cellWidth, cellHeight int
+	for _, m := range pixelSizeReply.FindAllSubmatch(replies, -1) {
+		height, _ := strconv.Atoi(string(m[2]))
+		width, _ := strconv.Atoi(string(m[3]))
+		switch string(m[1]) {
+		case "4":
+			ws.x, ws.y = clampUint16(width), clampUint16(height)
+		case "6":
+			cellWidth, cellHeight = width, height
+		}
+	}
+	if (ws.x == 0 || ws.y == 0) && cellWidth > 0 && cellHeight > 0 {
+		ws.x = clampUint16(cellWidth * int(ws.Width))
+		ws.y = clampUint16(cellHeight * int(ws.Height))
+	}
+	return ws, nil
+}
+
+func clampUint16(v int) uint16 {
+	if v < 0 {
+		return 0
+	}
+	if v > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(v)
+}
+
+// WinsizeSource describes where the size returned by [GetWinsizeOrDefault]
+// was obtained from.
+type WinsizeSource int
+
+const (
+	// WinsizeFromFd means the size is that of the terminal connected to the
+	// given file descriptor.
+	WinsizeFromFd WinsizeSource = iota
+	// WinsizeFromControllingTerminal means the size is that of the
+	// controlling terminal of the process.
+	WinsizeFromControllingTerminal
+	// WinsizeFromEnv means the size was read from the COLUMNS and LINES
+	// environment variables.
+	WinsizeFromEnv
+	// WinsizeFromDefault means the size is the default given by the caller.
+	WinsizeFromDefault
+)
+
+// String implements [fmt.Stringer].
+func (s WinsizeSource) String() string {
+	switch s {
+	case WinsizeFromFd:
+		return "fd"
+	case WinsizeFromControllingTerminal:
+		return "controlling terminal"
+	case WinsizeFromEnv:
+		return "environment"
+	case WinsizeFromDefault:
+		return "default"
+	default:
+		return "WinsizeSource(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// GetWinsizeOrDefault returns the size of the terminal connected to the given
+// file descriptor, falling back to other sources when it is not a terminal,
+// for example because the output is redirected to a pipe or a file. The
+// sources are tried in order:
+//
+//   - the terminal connected to fd;
+//   - the controlling terminal of the process ("/dev/tty" on Unix, the
+//     active console screen buffer on Windows);
+//   - the COLUMNS and LINES environment variables, where a missing or invalid
+//     variable takes its value from def;
+//   - def.
+//
+// Sources that report a zero width or height are skipped. The returned
+// WinsizeSource reports which source was used.
+func GetWinsizeOrDefault(fd uintptr, def Winsize) (*Winsize, WinsizeSource) {
+	if ws, err := GetWinsize(fd); err == nil && ws.Width > 0 && ws.Height > 0 {
+		return ws, WinsizeFromFd
+	}
+	if ws, err := controllingTerminalWinsize(); err == nil && ws.Width > 0 && ws.Height > 0 {
+		return ws, WinsizeFromControllingTerminal
+	}
+	width, widthOK := winsizeFromEnv("COLUMNS")
+	height, heightOK := winsizeFromEnv("LINES")
+	if widthOK || heightOK {
+		ws := def
+		if widthOK {
+			ws.Width = width
+		}
+		if heightOK {
+			ws.Height = height
+		}
+		return &ws, WinsizeFromEnv
+	}
+	return &def, WinsizeFromDefault
+}
+
+func winsizeFromEnv(name string) (uint16, bool) {
+	v, err := strconv.ParseUint(os.Getenv(name), 10, 16)
+	if err != nil || v == 0 {
+		return 0, false
+	}
+	return uint16(v), true
+}
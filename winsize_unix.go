@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package term
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchWinsize returns a channel that receives a value when the size of the
+// terminal may have changed. Bursts of SIGWINCH are coalesced by the channel
+// buffer. The returned function stops watching.
+func watchWinsize() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGWINCH)
+	return ch, func() { signal.Stop(ch) }
+}
@@ -0,0 +1,16 @@
+package term
+
+import "time"
+
+// winsizePollInterval is the interval at which the console screen buffer is
+// polled for size changes.
+const winsizePollInterval = 250 * time.Millisecond
+
+// watchWinsize returns a channel that receives a value when the size of the
+// console may have changed. Windows has no equivalent of SIGWINCH that does
+// not require consuming console input events, so this is a ticker. The
+// returned function stops watching.
+func watchWinsize() (<-chan time.Time, func()) {
+	t := time.NewTicker(winsizePollInterval)
+	return t.C, t.Stop
+}